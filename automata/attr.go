@@ -0,0 +1,90 @@
+package automata
+
+import "sort"
+import "strings"
+
+// State attributes (the Attr of DFAstate and NFAstate) follow the states
+// through the operations:
+//
+//   - ToDFA and ToDFAWithOptions give a dfa state the merge of the Attr of
+//     the nfa states in its subset.
+//   - Product and the operations on top of it give a pair the merge of the
+//     Attr of its two states, the sink having none.
+//   - Minimize never merges states with different Attr, so states labelled
+//     differently stay apart even when they accept the same words.
+//   - Copy, Complete, Complement and RemoveEpsilon keep them, new states
+//     like the dead one get none.
+//   - SerializeV2 and MarshalJSON write them and ParseV2 and UnmarshalJSON
+//     read them back. The older format of Serialize has no room for them.
+//
+// Merging uses MergeAttrUnion unless another AttrMerge is given.
+//
+// AttrMerge combines the Attr of the states making up a new one. attrs holds
+// the non-empty ones in a fixed order: sorted by state id for a subset, dfa1
+// before dfa2 for a product. It is not called when there are none.
+type AttrMerge func(attrs []map[string]string) map[string]string
+
+// MergeAttrUnion keeps every key. Values that differ are joined by "," in
+// sorted order, without repeats.
+func MergeAttrUnion(attrs []map[string]string) map[string]string {
+	values := make(map[string]Set)
+	for _, attr := range attrs {
+		for k, v := range attr {
+			if _, ok := values[k]; !ok {
+				values[k] = NewSet()
+			}
+			values[k].Insert(v)
+		}
+	}
+	merged := make(map[string]string)
+	for k, s := range values {
+		merged[k] = strings.Join(sortedKeys(s), ",")
+	}
+	return merged
+}
+
+// MergeAttrFirst keeps the value of the first state having the key
+func MergeAttrFirst(attrs []map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, attr := range attrs {
+		for k, v := range attr {
+			if _, ok := merged[k]; !ok {
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+// mergeAttr merges the non-empty attrs into dst
+func mergeAttr(dst map[string]string, merge AttrMerge, attrs ...map[string]string) {
+	if merge == nil {
+		merge = MergeAttrUnion
+	}
+	var nonempty []map[string]string
+	for _, attr := range attrs {
+		if len(attr) > 0 {
+			nonempty = append(nonempty, attr)
+		}
+	}
+	if len(nonempty) == 0 {
+		return
+	}
+	for k, v := range merge(nonempty) {
+		dst[k] = v
+	}
+}
+
+// attrKey is the same for equal Attr
+func attrKey(attr map[string]string) string {
+	var keys []string
+	for k, _ := range attr {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(k + "\x00" + attr[k] + "\x00")
+	}
+	return sb.String()
+}
@@ -4,7 +4,7 @@ import "fmt"
 import "sort"
 import "strings"
 import "io/ioutil"
-import "github.com/golang-collections/go-datastructures/queue"
+import "sync"
 
 type Automata interface {
 	GetStart() string
@@ -142,6 +142,14 @@ func (dfa *DFA) Trans(fromstate string, symbols []string) string {
 	return dfa.Trans(state, symbols[1:])
 }
 
+func (dfa *DFA) step(fromstate string, symbol string) string { // "" if no way to go
+	state_obj, ok := dfa.States[fromstate]
+	if !ok {
+		return ""
+	}
+	return state_obj.Trans[symbol]
+}
+
 func (dfa *DFA) TransTable() [][]string { // from_state symbol to_state Startstate or Finstate?
 	var transtable [][]string
 
@@ -198,6 +206,27 @@ func (nfa *NFA) GetStates() map[string]*NFAstate {
 	return nfa.States
 }
 
+func (nfa *NFA) addTrans(from string, symbol string, to string) {
+	_, ok := nfa.States[from]
+	if !ok {
+		nfa.States[from] = NewNFAstate(from)
+	}
+	_, ok = nfa.States[to]
+	if !ok { // state may only apper in dst part
+		nfa.States[to] = NewNFAstate(to)
+	}
+	state_obj := nfa.States[from]
+	trans := state_obj.Trans
+	_, ok = trans[symbol]
+	if !ok {
+		tmp := NewSet()
+		tmp.Insert(to)
+		trans[symbol] = tmp
+	} else {
+		trans[symbol].Insert(to)
+	}
+}
+
 func (nfa *NFA) Trans(fromstate string, symbols []string) Set { //fromstate is always correct
 	if len(symbols) == 0 {
 		s := NewSet()
@@ -253,21 +282,74 @@ func (nfa *NFA) TransTable() [][]string { // from_state symbol to_state Startsta
 
 type eNFA struct {
 	NFA
+	mu     sync.RWMutex
+	eclose map[string]Set // epsilon closure of each state, built on demand
 }
 
 func NeweNFA() *eNFA {
 	nfa := NewNFA()
-	return &eNFA{*nfa}
+	return &eNFA{NFA: *nfa}
 }
 
-func (enfa *eNFA) Eclose(states Set) Set {
-	s := states.Copy()
-	for state, _ := range states {
-		dsts, ok := enfa.States[state].Trans[epsilon] //didn't check if state exists
+// AddState and AddTrans change the eNFA and drop the cached closures. After
+// editing States directly, call InvalidateEclose.
+func (enfa *eNFA) AddState(id string) {
+	if _, ok := enfa.States[id]; !ok {
+		enfa.States[id] = NewNFAstate(id)
+	}
+	enfa.InvalidateEclose()
+}
+
+func (enfa *eNFA) AddTrans(from string, symbol string, to string) {
+	enfa.addTrans(from, symbol, to)
+	enfa.InvalidateEclose()
+}
+
+func (enfa *eNFA) InvalidateEclose() {
+	enfa.mu.Lock()
+	enfa.eclose = nil
+	enfa.mu.Unlock()
+}
+
+// closure returns every state reachable from state by epsilon moves, state
+// included. It is computed once and cached, so the set must not be changed.
+// Readers may share the eNFA across goroutines, writers may not.
+func (enfa *eNFA) closure(state string) Set {
+	enfa.mu.RLock()
+	s, ok := enfa.eclose[state]
+	enfa.mu.RUnlock()
+	if ok {
+		return s
+	}
+	s = NewSet()
+	s.Insert(state)
+	stack := []string{state}
+	for len(stack) > 0 { // follow epsilon until nothing new
+		state_obj, ok := enfa.States[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
 		if !ok {
 			continue
 		}
-		for dst, _ := range dsts {
+		for dst, _ := range state_obj.Trans[epsilon] {
+			if !s.Has(dst) {
+				s.Insert(dst)
+				stack = append(stack, dst)
+			}
+		}
+	}
+	enfa.mu.Lock()
+	if enfa.eclose == nil {
+		enfa.eclose = make(map[string]Set)
+	}
+	enfa.eclose[state] = s
+	enfa.mu.Unlock()
+	return s
+}
+
+func (enfa *eNFA) Eclose(states Set) Set {
+	s := NewSet()
+	for state, _ := range states {
+		for dst, _ := range enfa.closure(state) {
 			s.Insert(dst)
 		}
 	}
@@ -326,6 +408,9 @@ func Desearialize(s string, at Automata, insert func(string, string, string, Aut
 	}
 	at.SetStart(lines[0])
 	for _, s := range strings.Split(lines[1], " ") {
+		if s == "" { // no finish state at all
+			continue
+		}
 		at.GetFinish().Insert(s)
 	}
 	for _, s := range lines[2:] {
@@ -358,25 +443,7 @@ func DFADeserialize(s string) *DFA {
 func NFADeserialize(s string) *NFA {
 
 	insert := func(from string, symbol string, to string, at Automata) {
-		nfa := at.(*NFA)
-		_, ok := nfa.States[from]
-		if !ok {
-			nfa.States[from] = NewNFAstate(from)
-		}
-		_, ok = nfa.States[to]
-		if !ok { // state may only apper in dst part
-			nfa.States[to] = NewNFAstate(to)
-		}
-		state_obj := nfa.States[from]
-		trans := state_obj.Trans
-		_, ok = trans[symbol]
-		if !ok {
-			tmp := NewSet()
-			tmp.Insert(to)
-			trans[symbol] = tmp
-		} else {
-			trans[symbol].Insert(to)
-		}
+		at.(*NFA).addTrans(from, symbol, to)
 	}
 	nfa := NewNFA()
 	Desearialize(s, nfa, insert)
@@ -386,7 +453,7 @@ func NFADeserialize(s string) *NFA {
 
 func eNFADeserialize(e string) *eNFA {
 	nfa := NFADeserialize(e)
-	return &eNFA{*nfa}
+	return &eNFA{NFA: *nfa}
 }
 
 func Accept(at Automata, symbols []string) bool {
@@ -397,6 +464,8 @@ func Accept(at Automata, symbols []string) bool {
 	case *DFA:
 		s := a.Trans(start, symbols)
 		stop_states.Insert(s)
+	case *LazyDFA:
+		return a.Match(symbols)
 	case *NFA:
 		stop_states = a.Trans(start, symbols)
 	case *eNFA:
@@ -415,79 +484,46 @@ func Accept(at Automata, symbols []string) bool {
 	return false
 }
 
-func ToDFA(nfa NFAAutomata) *DFA {
-	DFAStates := NewSet()
-	var DFATrans map[string]map[string]Set
-	DFATrans = make(map[string]map[string]Set) //trans[states][symbols] -> statesSet
-	DFAFinish := NewSet()
-
-	q := queue.New(10)
-	DFA_start_state := NewSet()
-	DFA_start_state.Insert(nfa.GetStart())
-
-	switch enfa := nfa.(type) { // eclose for start
-	case *eNFA:
-		DFA_start_state = enfa.Eclose(DFA_start_state)
-	}
-
-	DFAStates.Insert(DFA_start_state.String())
-	q.Put(DFA_start_state)
-	for !q.Empty() {
-		_states, _ := q.Get(1) //get a dfa states
-		states := _states[0].(Set)
-		states_str := states.String()
-
-		DFATrans[states_str] = make(map[string]Set)
-		trans_for_the_state := DFATrans[states_str]
-		for state, _ := range states {
-			trans := nfa.GetStates()[state].Trans
-			for sb, dsts := range trans {
-				_, ok := trans_for_the_state[sb]
-				if !ok {
-					trans_for_the_state[sb] = NewSet()
-				}
-				for dst, _ := range dsts {
-					trans_for_the_state[sb].Insert(dst)
-				}
-
-				switch enfa := nfa.(type) { // eclose for the enfa
-				case *eNFA:
-					trans_for_the_state[sb] = enfa.Eclose(trans_for_the_state[sb])
-				}
+// startStates and nextStates simulate any automata on sets of states, after
+// epsilon closure for an eNFA. A dfa has at most one state in the set.
+func startStates(at Automata) Set {
+	at = unwrap(at)
+	s := NewSet()
+	s.Insert(at.GetStart())
+	if enfa, ok := at.(*eNFA); ok {
+		return enfa.Eclose(s)
+	}
+	return s
+}
 
+func nextStates(at Automata, fromstates Set, symbol string) Set {
+	switch a := unwrap(at).(type) {
+	case *DFA:
+		next_states := NewSet()
+		for state, _ := range fromstates {
+			if dst := a.step(state, symbol); dst != "" {
+				next_states.Insert(dst)
 			}
 		}
-		for _, states := range trans_for_the_state {
-			states_str := states.String()
-			if !DFAStates.Has(states_str) { //if never seen, put into the queue
-				q.Put(states)
-				DFAStates.Insert(states_str)
-				// check whether is a finish state
-				for s, _ := range nfa.GetFinish() {
-					if states.Has(s) {
-						DFAFinish.Insert(states_str)
-					}
-				}
-			}
-		}
+		return next_states
+	case *NFA:
+		return a.NextStates(fromstates, symbol)
+	case *eNFA:
+		return a.Eclose(a.NextStates(fromstates, symbol))
+	default:
+		panic("Unknown automata type")
 	}
+}
 
-	dfa := NewDFA()
-	for state, _ := range DFAStates {
-		s := NewDFAstate()
-		s.Id = state
-		dfa.States[state] = s
-	}
-	for state_str, trans := range DFATrans {
-		s := dfa.States[state_str]
-		for sb, dsts := range trans {
-			dst_state := dsts.String()
-			s.Trans[sb] = dst_state
-		}
+// ToDFA runs the subset construction over the reachable sets of states. See
+// subsetBuilder for how the sets are stored. The Attr of the states in a set
+// are merged by MergeAttrUnion, see AttrMerge.
+func ToDFA(nfa NFAAutomata) *DFA {
+	b := newSubsetBuilder(nfa)
+	for i := 0; i < len(b.sets); i++ {
+		b.expand(i)
 	}
-	dfa.Start = DFA_start_state.String()
-	dfa.Finish = DFAFinish
-	return dfa
+	return b.dfa(nil)
 }
 
 func main() {
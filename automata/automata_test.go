@@ -1,11 +1,17 @@
 package automata
 
+import "context"
+import "encoding/json"
+import "errors"
 import "testing"
 import "io/ioutil"
 import "strings"
 import "sort"
+import "math/big"
+import "math/rand"
 
 import "fmt"
+import "time"
 
 func Makelist(s string) []string {
 	sb_list := make([]string, 0, 5)
@@ -500,3 +506,1380 @@ P -> A
 	}
 
 }
+
+func TestMinimize(t *testing.T) {
+	read_dfa := func(dat_path string) *DFA {
+		dat, err := ioutil.ReadFile(dat_path)
+		if err != nil {
+			t.Errorf("Can not find %s", dat_path)
+		}
+		return ToDFA(eNFADeserialize(string(dat)))
+	}
+
+	dfa := read_dfa("../resources/decimal.enfa")
+	min := Minimize(dfa)
+	for _, c := range decimial_cases {
+		if Accept(min, Makelist(c.in)) != c.want {
+			t.Errorf("test for %s, expect %t", c.in, c.want)
+		}
+	}
+	DFAequal(min, Minimize(read_dfa("../resources/decimal.enfa")), t)
+	DFAequal(min, Minimize(min), t)
+
+	cases := []struct {
+		path   string
+		states int
+	}{
+		{"../resources/01stringendwith01.nfa", 3},
+		{"../resources/exponentialdfa.nfa", 256},
+	}
+	for _, c := range cases {
+		min := Minimize(read_dfa(c.path))
+		if len(min.States) != c.states {
+			t.Errorf("%s: expect %d states, got %d", c.path, c.states, len(min.States))
+		}
+	}
+
+	const redundant = `A
+C D E
+A 0 B
+A 1 C
+B 0 A
+B 1 D
+C 0 E
+C 1 F
+D 0 E
+D 1 F
+E 0 E
+E 1 F
+F 0 F
+F 1 F
+G 0 A
+`
+	const target = `q0
+q1
+q0 0 q0
+q0 1 q1
+q1 0 q1
+`
+	min = Minimize(DFADeserialize(redundant))
+	DFAequal(min, DFADeserialize(target), t)
+}
+
+func TestEquivalent(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	enfa := eNFADeserialize(string(dat))
+	dat, _ = ioutil.ReadFile("../resources/01stringendwith01.nfa")
+	nfa := NFADeserialize(string(dat))
+
+	if ok, word := Equivalent(enfa, Minimize(ToDFA(enfa))); !ok {
+		t.Errorf("decimal machines differ on %v", word)
+	}
+	if ok, word := Equivalent(nfa, ToDFA(nfa)); !ok {
+		t.Errorf("01 machines differ on %v", word)
+	}
+
+	const endwith1 = `q0
+q1
+q0 0 q0
+q0 1 q0
+q0 1 q1
+`
+	ok, word := Equivalent(nfa, NFADeserialize(endwith1))
+	if ok || strings.Join(word, "") != "1" {
+		t.Errorf("expect counterexample 1, got %v", word)
+	}
+	ok, word = Equivalent(enfa, nfa)
+	if ok || strings.Join(word, "") != ".0" {
+		t.Errorf("expect counterexample .0, got %v", word)
+	}
+}
+
+func TestProduct(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	decimal := ToDFA(eNFADeserialize(string(dat)))
+	dat, _ = ioutil.ReadFile("../resources/01stringendwith01.nfa")
+	endwith01 := ToDFA(NFADeserialize(string(dat)))
+
+	ops := []struct {
+		name string
+		op   func(*DFA, *DFA) *DFA
+		want func(bool, bool) bool
+	}{
+		{"Intersect", Intersect, func(a, b bool) bool { return a && b }},
+		{"Union", Union, func(a, b bool) bool { return a || b }},
+		{"Difference", Difference, func(a, b bool) bool { return a && !b }},
+		{"SymmetricDifference", SymmetricDifference, func(a, b bool) bool { return a != b }},
+	}
+	words := []string{"", "01", "1.01", "1.0", "-1.01", "0101", ".01", "1.", "a", "10.1"}
+	for _, op := range ops {
+		dfa := DFADeserialize(Serialize(op.op(decimal, endwith01)))
+		for _, w := range words {
+			in := Makelist(w)
+			want := op.want(Accept(decimal, in), Accept(endwith01, in))
+			if Accept(dfa, in) != want {
+				t.Errorf("%s for %s, expect %t", op.name, w, want)
+			}
+		}
+	}
+
+	empty := NewDFA()
+	empty.Start = "q0"
+	if ok, word := Equivalent(Intersect(decimal, endwith01), empty); !ok {
+		t.Errorf("intersection accepts %v", word)
+	}
+	if ok, word := Equivalent(SymmetricDifference(decimal, decimal), empty); !ok {
+		t.Errorf("symmetric difference with itself accepts %v", word)
+	}
+}
+
+func TestComplement(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/01stringendwith01.nfa")
+	dfa := ToDFA(NFADeserialize(string(dat)))
+	alphabet := []string{"0", "1", "2"}
+
+	complete := Complete(dfa, alphabet)
+	for state, state_obj := range complete.States {
+		if len(state_obj.Trans) != 3 {
+			t.Errorf("state %s is not complete: %v", state, state_obj.Trans)
+		}
+	}
+	if len(complete.Symbols) != 3 {
+		t.Errorf("expect 3 symbols, got %d", len(complete.Symbols))
+	}
+	if ok, word := Equivalent(dfa, complete); !ok {
+		t.Errorf("completion changes the language on %v", word)
+	}
+
+	complement := Complement(dfa, alphabet)
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"", true},
+		{"0", true},
+		{"01", false},
+		{"1101", false},
+		{"012", true},
+		{"2", true},
+		{"a", false},
+	}
+	for _, c := range cases {
+		if Accept(complement, Makelist(c.in)) != c.want {
+			t.Errorf("test for %s, expect %t", c.in, c.want)
+		}
+	}
+	if ok, word := Equivalent(dfa, Complement(complement, alphabet)); !ok {
+		t.Errorf("double complement differs on %v", word)
+	}
+}
+
+func TestEcloseChains(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("q0\nq100\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, "q%d epsilon q%d\n", i, i+1)
+	}
+	chain := eNFADeserialize(sb.String())
+	if !Accept(chain, []string{}) || !Accept(ToDFA(chain), []string{}) {
+		t.Errorf("the end of the epsilon chain is not reached")
+	}
+	if n := len(chain.ETrans("q0", nil)); n != 101 {
+		t.Errorf("expect 101 states in the closure, got %d", n)
+	}
+
+	const cycle = `q0
+q4
+q0 epsilon q1
+q1 epsilon q2
+q2 epsilon q0
+q2 a q3
+q3 epsilon q4
+q4 epsilon q3
+q4 epsilon q0
+`
+	enfa := eNFADeserialize(cycle)
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{"a", true},
+		{"aaa", true},
+		{"b", false},
+	}
+	for _, at := range []Automata{enfa, ToDFA(enfa)} {
+		for _, c := range cases {
+			if Accept(at, Makelist(c.in)) != c.want {
+				t.Errorf("test for %s, expect %t", c.in, c.want)
+			}
+		}
+	}
+	if s := enfa.ETrans("q0", []string{"a"}); s.String() != "q0,q1,q2,q3,q4" {
+		t.Errorf("unexpected closure %s", s)
+	}
+
+	// the cache follows changes
+	enfa.AddTrans("q1", epsilon, "q4")
+	if !Accept(enfa, []string{}) {
+		t.Errorf("AddTrans did not reset the closures")
+	}
+	enfa.States["q1"].Trans[epsilon].Delete("q4")
+	enfa.InvalidateEclose()
+	if Accept(enfa, []string{}) {
+		t.Errorf("InvalidateEclose did not reset the closures")
+	}
+
+	// readers share the cache
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func() {
+			ok := true
+			for j := 0; j < 100; j++ {
+				ok = ok && Accept(enfa, Makelist("aa")) && !Accept(enfa, Makelist("ab"))
+			}
+			done <- ok
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if !<-done {
+			t.Errorf("concurrent Accept went wrong")
+		}
+	}
+}
+
+func TestParseRegex(t *testing.T) {
+	enfa, err := ParseRegex(`[+\-]?[0-9]*(\.[0-9]|[0-9]\.)[0-9]*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range decimial_cases {
+		if Accept(enfa, Makelist(c.in)) != c.want {
+			t.Errorf("test for %s, expect %t", c.in, c.want)
+		}
+	}
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	if ok, word := Equivalent(enfa, eNFADeserialize(string(dat))); !ok {
+		t.Errorf("regex and decimal.enfa differ on %v", word)
+	}
+	if ok, word := Equivalent(enfa, eNFADeserialize(Serialize(enfa))); !ok {
+		t.Errorf("serialized regex differs on %v", word)
+	}
+
+	cases := []struct {
+		regex string
+		in    string
+		want  bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"a|b", "b", true},
+		{"ab*c", "ac", true},
+		{"ab*c", "abbbc", true},
+		{"ab+c", "ac", false},
+		{"(ab)+", "abab", true},
+		{"(ab)+", "aba", false},
+		{"(a*)*b", "aaab", true},
+		{"a?b", "b", true},
+		{"a?b", "aab", false},
+		{"(a|)(b|c)", "c", true},
+		{`\(\*\)`, "(*)", true},
+		{"[a-c-]x", "-x", true},
+		{"[a-c-]x", "dx", false},
+		{".", ".", true},
+		{".", "a", false},
+	}
+	for _, c := range cases {
+		enfa, err := ParseRegex(c.regex)
+		if err != nil {
+			t.Errorf("%s: %v", c.regex, err)
+			continue
+		}
+		if Accept(enfa, Makelist(c.in)) != c.want {
+			t.Errorf("%s for %s, expect %t", c.regex, c.in, c.want)
+		}
+		if Accept(ToDFA(enfa), Makelist(c.in)) != c.want {
+			t.Errorf("%s for %s on dfa, expect %t", c.regex, c.in, c.want)
+		}
+	}
+
+	for _, bad := range []string{"(a", "a)", "*a", "a|+", "[a", "[z-a]", "[]", "[^a]", `a\`} {
+		if _, err := ParseRegex(bad); err == nil {
+			t.Errorf("%s should not parse", bad)
+		}
+	}
+}
+
+func TestToRegex(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/01stringendwith01.nfa")
+	nfa := NFADeserialize(string(dat))
+	if r := ToRegex(nfa); r != "[01]*01" {
+		t.Errorf("expect [01]*01, got %s", r)
+	}
+
+	for _, path := range []string{"../resources/01stringendwith01.nfa", "../resources/decimal.enfa"} {
+		dat, _ := ioutil.ReadFile(path)
+		enfa := eNFADeserialize(string(dat))
+		for _, at := range []Automata{enfa, ToDFA(enfa), Minimize(ToDFA(enfa))} {
+			r := ToRegex(at)
+			back, err := ParseRegex(r)
+			if err != nil {
+				t.Errorf("%s: %s does not parse: %v", path, r, err)
+				continue
+			}
+			if ok, word := Equivalent(at, back); !ok {
+				t.Errorf("%s: %s differs on %v", path, r, word)
+			}
+		}
+	}
+
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"a", "a"},
+		{"a*", "a*"},
+		{"(ab)*", "(ab)*"},
+		{"a|b|cd", "[ab]|cd"},
+		{"(a|b)?c", "[ab]?c"},
+		{`\*\|x+`, `\*\|xx*`},
+		{"((a*)*b)*", "(a*b)*"},
+		{"(a|b)*abb", "[ab]*abb"},
+	}
+	for _, c := range cases {
+		enfa, _ := ParseRegex(c.in)
+		r := ToRegex(enfa)
+		if r != c.want {
+			t.Errorf("%s: expect %s, got %s", c.in, c.want, r)
+		}
+		back, err := ParseRegex(r)
+		if err != nil {
+			t.Errorf("%s: %s does not parse: %v", c.in, r, err)
+			continue
+		}
+		if ok, word := Equivalent(enfa, back); !ok {
+			t.Errorf("%s: %s differs on %v", c.in, r, word)
+		}
+	}
+
+	empty := NewDFA()
+	empty.Start = "q0"
+	if r := ToRegex(empty); r != "∅" {
+		t.Errorf("expect ∅, got %s", r)
+	}
+}
+
+func TestProperties(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	decimal := eNFADeserialize(string(dat))
+	dat, _ = ioutil.ReadFile("../resources/01stringendwith01.nfa")
+	endwith01 := NFADeserialize(string(dat))
+
+	for _, at := range []Automata{decimal, ToDFA(decimal)} {
+		empty, word := IsEmpty(at)
+		if empty || len(word) != 2 || !Accept(at, word) {
+			t.Errorf("expect a witness of length 2, got %v", word)
+		}
+		if IsFinite(at) {
+			t.Errorf("decimal numbers are infinite")
+		}
+	}
+	if empty, word := IsEmpty(endwith01); empty || strings.Join(word, "") != "01" {
+		t.Errorf("expect witness 01, got %v", word)
+	}
+	if _, finite := LanguageSize(endwith01); finite {
+		t.Errorf("expect an infinite language")
+	}
+
+	enfa, _ := ParseRegex("(a|b)(c|d)?(e|)")
+	if !IsFinite(enfa) {
+		t.Errorf("expect a finite language")
+	}
+	if n, finite := LanguageSize(enfa); !finite || n.Int64() != 12 {
+		t.Errorf("expect 12 words, got %v", n)
+	}
+	enfa, _ = ParseRegex("a()*b")
+	if n, finite := LanguageSize(enfa); !finite || n.Int64() != 1 {
+		t.Errorf("epsilon cycles do not make the language infinite, got %v", n)
+	}
+	if n, _ := LanguageSize(Intersect(ToDFA(decimal), ToDFA(endwith01))); n.Int64() != 0 {
+		t.Errorf("expect 0 words, got %v", n)
+	}
+	if empty, _ := IsEmpty(Intersect(ToDFA(decimal), ToDFA(endwith01))); !empty {
+		t.Errorf("expect an empty language")
+	}
+
+	enfa, _ = ParseRegex("[ab]*")
+	if universal, word := IsUniversal(enfa, []string{"a", "b"}); !universal {
+		t.Errorf("expect universal, rejected %v", word)
+	}
+	if universal, word := IsUniversal(enfa, []string{"a", "b", "c"}); universal || strings.Join(word, "") != "c" {
+		t.Errorf("expect c to be rejected, got %v", word)
+	}
+	if universal, word := IsUniversal(endwith01, []string{"0", "1"}); universal || len(word) != 0 {
+		t.Errorf("expect the empty word to be rejected, got %v", word)
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	collect := func(ch <-chan []string) []string {
+		var words []string
+		for word := range ch {
+			words = append(words, strings.Join(word, ""))
+		}
+		return words
+	}
+
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	decimal := eNFADeserialize(string(dat))
+	words := collect(Enumerate(context.Background(), decimal, 2))
+	if len(words) != 20 || words[0] != ".0" || words[9] != ".9" || words[10] != "0." {
+		t.Errorf("unexpected words %v", words)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Enumerate(ctx, decimal, -1)
+	var prev []string
+	for i := 0; i < 500; i++ {
+		word := <-ch
+		if !Accept(decimal, word) {
+			t.Errorf("%v is not accepted", word)
+		}
+		if prev != nil && (len(word) < len(prev) ||
+			len(word) == len(prev) && strings.Join(word, "\x00") <= strings.Join(prev, "\x00")) {
+			t.Errorf("%v comes after %v", word, prev)
+		}
+		prev = word
+	}
+	cancel()
+	for _ = range ch { // closed after cancel
+	}
+
+	enfa, _ := ParseRegex("(a|b)(c|d)?(e|)")
+	for _, at := range []Automata{enfa, ToDFA(enfa), Minimize(ToDFA(enfa))} {
+		words = collect(Enumerate(context.Background(), at, -1))
+		if strings.Join(words, " ") != "a b ac ad ae bc bd be ace ade bce bde" {
+			t.Errorf("unexpected words %v", words)
+		}
+	}
+}
+
+func TestCountAndSample(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/exponentialdfa.nfa")
+	dfa := ToDFA(NFADeserialize(string(dat)))
+	counts := CountByLength(dfa, 100)
+	for k, c := range counts {
+		want := big.NewInt(0)
+		if k >= 8 {
+			want.Lsh(big.NewInt(1), uint(k-1))
+		}
+		if c.Cmp(want) != 0 {
+			t.Errorf("length %d: expect %v words, got %v", k, want, c)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		word, ok := SampleUniform(dfa, 20, rng)
+		if !ok || len(word) != 20 || !Accept(dfa, word) {
+			t.Errorf("bad sample %v", word)
+		}
+	}
+	if _, ok := SampleUniform(dfa, 5, rng); ok {
+		t.Errorf("no word of length 5 is accepted")
+	}
+
+	enfa, _ := ParseRegex("[ab]c|d[ef]|gh?")
+	hist := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		word, _ := SampleUniform(ToDFA(enfa), 2, rng)
+		hist[strings.Join(word, "")]++
+	}
+	if len(hist) != 5 {
+		t.Errorf("expect 5 different words, got %v", hist)
+	}
+	for word, n := range hist {
+		if n < 650 || n > 950 {
+			t.Errorf("%s drawn %d times out of 4000", word, n)
+		}
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	const nfa = `q0
+q2
+q0 epsilon q1
+q0 a q1
+q0 b q1
+q1 "x" q2
+`
+	const target = `digraph automata {
+	rankdir=LR;
+	"__start" [shape=point];
+	"q0" [shape=circle];
+	"q1" [shape=circle];
+	"q2" [shape=doublecircle];
+	"__start" -> "q0";
+	"q0" -> "q1" [label="a,b,ε"];
+	"q1" -> "q2" [label="\"x\""];
+}
+`
+	enfa := eNFADeserialize(nfa)
+	if s := ToDOT(enfa); s != target {
+		t.Errorf("unexpected DOT:\n%s", s)
+	}
+	if s := ToDOT(NFADeserialize(nfa)); !strings.Contains(s, `[label="a,b,epsilon"]`) {
+		t.Errorf("epsilon is a plain symbol in an NFA:\n%s", s)
+	}
+	dfa := ToDFA(enfa)
+	if ToDOT(dfa) != ToDOT(DFADeserialize(Serialize(dfa))) {
+		t.Errorf("DOT output is not stable")
+	}
+
+	const cfg_target = `digraph cfg {
+	"E" [shape=doublecircle];
+	"I" [shape=circle];
+	"E" -> "E";
+	"E" -> "I";
+	"I" -> "I";
+}
+`
+	if s := CFGDeserialize(expression).ToDOT(); s != cfg_target {
+		t.Errorf("unexpected DOT:\n%s", s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, path := range []string{"../resources/decimal.enfa", "../resources/nfa.txt", "../resources/exponentialdfa.nfa", "../resources/01stringendwith01.nfa"} {
+		dat, _ := ioutil.ReadFile(path)
+		enfa, err := ParseENFA(strings.NewReader(string(dat)))
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if ok, word := Equivalent(enfa, eNFADeserialize(string(dat))); !ok {
+			t.Errorf("%s: parsed automata differs on %v", path, word)
+		}
+		if _, err := ParseNFA(strings.NewReader(string(dat))); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	dat, _ := ioutil.ReadFile("../resources/dfa.txt")
+	if _, err := ParseDFA(strings.NewReader(string(dat))); err != nil {
+		t.Errorf("dfa.txt: %v", err)
+	}
+
+	bad := []struct {
+		in           string
+		err          error
+		line, column int
+	}{
+		{"q0\nq1\n", ErrTooFewLines, 3, 0},
+		{"q0 q1\nq1\nq0 a q1\n", ErrBadStart, 1, 0},
+		{"q0\nq1\nq0 a\n", ErrFieldCount, 3, 0},
+		{"q0\nq1\nq0 a q1 q2\n", ErrFieldCount, 3, 9},
+		{"q0\nq1\nq0  a q1\n", ErrEmptyField, 3, 4},
+		{"q0\nq1  q2\nq0 a q1\n", ErrEmptyField, 2, 4},
+		{"q0\nq1\nq0 a q1\n\nq1 a q0\n", ErrFieldCount, 4, 0},
+		{"q0\nq1\nq0 a q1\nq0 a q0\n", ErrNondeterministic, 4, 4},
+		{"s\nq1\nq0 a q1\n", ErrUnknownStart, 1, 1},
+	}
+	for _, c := range bad {
+		_, err := ParseDFA(strings.NewReader(c.in))
+		perr, ok := err.(*ParseError)
+		if !ok || !errors.Is(err, c.err) || perr.Line != c.line || perr.Column != c.column {
+			t.Errorf("%q: expect %v at %d:%d, got %v", c.in, c.err, c.line, c.column, err)
+		}
+	}
+	if _, err := ParseNFA(strings.NewReader("q0\nq1\nq0 a q1\nq0 a q0\n")); err != nil {
+		t.Errorf("an NFA may have several transitions: %v", err)
+	}
+	if _, err := ParseDFA(strings.NewReader("q0\nq1\nq0 a q1\nq0 a q1 \n")); err != nil {
+		t.Errorf("a repeated transition is fine: %v", err)
+	}
+
+	for _, grammar := range []string{palindrome, expression, expression_grammar} {
+		cfg, err := ParseCFG(strings.NewReader(grammar))
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		if CFGSerialize(cfg) != CFGSerialize(CFGDeserialize(grammar)) {
+			t.Errorf("parsed grammar differs from\n%s", grammar)
+		}
+	}
+	bad_cfg := []struct {
+		in           string
+		err          error
+		line, column int
+	}{
+		{"S -> A\nA \"a\"", ErrBadProduction, 2, 0},
+		{"S ->", ErrBadProduction, 1, 0},
+		{"S -> \"a", ErrUnterminatedQuote, 1, 6},
+		{"S -> A\n  A -> b\"", ErrUnterminatedQuote, 2, 8},
+	}
+	for _, c := range bad_cfg {
+		_, err := ParseCFG(strings.NewReader(c.in))
+		perr, ok := err.(*ParseError)
+		if !ok || !errors.Is(err, c.err) || perr.Line != c.line || perr.Column != c.column {
+			t.Errorf("%q: expect %v at %d:%d, got %v", c.in, c.err, c.line, c.column, err)
+		}
+	}
+}
+
+func TestFormatV2(t *testing.T) {
+	for _, path := range []string{"../resources/decimal.enfa", "../resources/01stringendwith01.nfa"} {
+		dat, _ := ioutil.ReadFile(path)
+		enfa := eNFADeserialize(string(dat))
+		for _, at := range []Automata{enfa, NFADeserialize(string(dat)), ToDFA(enfa)} {
+			s := SerializeV2(at)
+			back, err := ParseV2(strings.NewReader(s))
+			if err != nil {
+				t.Errorf("%s: %v\n%s", path, err, s)
+				continue
+			}
+			if SerializeV2(back) != s {
+				t.Errorf("%s: round trip changes\n%s\ninto\n%s", path, s, SerializeV2(back))
+			}
+			if ok, word := Equivalent(at, back); !ok {
+				t.Errorf("%s: round trip differs on %v", path, word)
+			}
+		}
+	}
+
+	const text = `# a machine with odd symbols
+automata v2 nfa
+alphabet: a "two words" "#" "start:"   # declared, "start:" is a symbol
+states: s f lonely
+start: s
+final: f
+s "two words" f
+s "#" f
+s "start:" s
+s a s
+`
+	at, err := ParseV2(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfa := at.(*NFA)
+	if _, ok := nfa.States["lonely"]; !ok || len(nfa.Symbols) != 4 {
+		t.Errorf("isolated state or alphabet lost")
+	}
+	if !Accept(nfa, []string{"a", "start:", "two words"}) || !Accept(nfa, []string{"#"}) {
+		t.Errorf("quoted symbols not read")
+	}
+	back, _ := ParseV2(strings.NewReader(SerializeV2(nfa)))
+	if _, ok := back.(*NFA).States["lonely"]; !ok {
+		t.Errorf("isolated state lost by SerializeV2:\n%s", SerializeV2(nfa))
+	}
+
+	const epsilon_text = "automata v2 enfa\nstart: a\nfinal: c\na epsilon b\nb epsilon c\n"
+	at, err = ParseV2(strings.NewReader(epsilon_text))
+	if err != nil || !Accept(at, []string{}) {
+		t.Errorf("epsilon moves not read: %v", err)
+	}
+
+	bad := []struct {
+		in           string
+		err          error
+		line, column int
+	}{
+		{"", ErrBadHeader, 1, 0},
+		{"automata v1 dfa\n", ErrBadHeader, 1, 0},
+		{"automata v2 pda\n", ErrBadHeader, 1, 13},
+		{"automata v2 dfa\nfinal: a\n", ErrMissingStart, 3, 0},
+		{"automata v2 dfa\nstart: a\nstart: b\n", ErrDuplicateDirective, 3, 1},
+		{"automata v2 dfa\nstart: a\na x\n", ErrFieldCount, 3, 0},
+		{"automata v2 dfa\nstart: a\na \"x b\n", ErrUnterminatedQuote, 3, 3},
+		{"automata v2 dfa\nalphabet: x\nstart: a\na y a\n", ErrUnknownSymbol, 4, 3},
+		{"automata v2 dfa\nstates: a\nstart: a\na x b\n", ErrUnknownState, 4, 5},
+		{"automata v2 dfa\nstates: a\nstart: b\n", ErrUnknownState, 3, 0},
+		{"automata v2 dfa\nstart: a\na x a\na x b\n", ErrNondeterministic, 4, 3},
+	}
+	for _, c := range bad {
+		_, err := ParseV2(strings.NewReader(c.in))
+		perr, ok := err.(*ParseError)
+		if !ok || !errors.Is(err, c.err) || perr.Line != c.line || perr.Column != c.column {
+			t.Errorf("%q: expect %v at %d:%d, got %v", c.in, c.err, c.line, c.column, err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	enfa := eNFADeserialize(string(dat))
+	enfa.States["q0"].Attr["label"] = "sign"
+	dfa := ToDFA(enfa)
+	dfa.States[dfa.Start].Attr["note"] = "start"
+
+	data, err := json.Marshal(enfa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enfa2 := NeweNFA()
+	if err := json.Unmarshal(data, enfa2); err != nil {
+		t.Fatal(err)
+	}
+	if ok, word := Equivalent(enfa, enfa2); !ok || enfa2.States["q0"].Attr["label"] != "sign" {
+		t.Errorf("eNFA round trip differs on %v", word)
+	}
+	data2, _ := json.Marshal(enfa2)
+	if string(data) != string(data2) {
+		t.Errorf("unstable json:\n%s\n%s", data, data2)
+	}
+
+	data, _ = json.Marshal(dfa)
+	var dfa2 DFA
+	if err := json.Unmarshal(data, &dfa2); err != nil {
+		t.Fatal(err)
+	}
+	DFAequal(dfa, &dfa2, t)
+	if dfa2.States[dfa2.Start].Attr["note"] != "start" {
+		t.Errorf("attr lost")
+	}
+	var nfa NFA
+	if err := json.Unmarshal(data, &nfa); err == nil {
+		t.Errorf("a dfa is not read as an nfa")
+	}
+
+	const small = `{"type":"enfa","alphabet":["a"],"start":"s","final":["f"],"states":[{"id":"f"},{"id":"s","attr":{"k":"v"}}],"transitions":[{"from":"s","epsilon":true,"to":"f"},{"from":"s","symbol":"a","to":"s"}]}`
+	if err := json.Unmarshal([]byte(small), enfa2); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(enfa2); string(data) != small {
+		t.Errorf("unexpected json %s", data)
+	}
+	if err := json.Unmarshal([]byte(strings.Replace(small, "enfa", "nfa", 1)), &nfa); err == nil {
+		t.Errorf("epsilon in an nfa should fail")
+	}
+
+	cfg := CFGDeserialize(palindrome)
+	data, _ = json.Marshal(cfg)
+	var cfg2 CFG
+	if err := json.Unmarshal(data, &cfg2); err != nil {
+		t.Fatal(err)
+	}
+	if CFGSerialize(cfg) != CFGSerialize(&cfg2) {
+		t.Errorf("cfg round trip differs:\n%s", data)
+	}
+	if !strings.Contains(string(data), `{"type":"terminal","value":"0"},{"type":"variable","value":"S"}`) {
+		t.Errorf("symbols not tagged: %s", data)
+	}
+}
+
+func TestRemoveEpsilon(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	decimal := eNFADeserialize(string(dat))
+	regex, _ := ParseRegex("(a|b*)*c?(d|)")
+	for _, enfa := range []*eNFA{decimal, regex} {
+		nfa := RemoveEpsilon(enfa)
+		if ok, word := Equivalent(enfa, nfa); !ok {
+			t.Errorf("languages differ on %v", word)
+		}
+		for _, record := range nfa.TransTable() {
+			if record[1] == epsilon {
+				t.Errorf("epsilon move left: %v", record)
+			}
+		}
+		for state, _ := range nfa.States {
+			if _, ok := enfa.States[state]; !ok {
+				t.Errorf("new state %s", state)
+			}
+		}
+	}
+	for _, c := range decimial_cases {
+		if Accept(RemoveEpsilon(decimal), Makelist(c.in)) != c.want {
+			t.Errorf("test for %s, expect %t", c.in, c.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	dfa := ToDFA(eNFADeserialize(string(dat)))
+	m := dfa.Compile()
+	for _, c := range decimial_cases {
+		if m.Match(Makelist(c.in)) != c.want || m.MatchBytes([]byte(c.in)) != c.want || m.MatchRunes([]rune(c.in)) != c.want {
+			t.Errorf("test for %s, expect %t", c.in, c.want)
+		}
+	}
+	if m.MatchRunes([]rune("1.5é")) || m.MatchRunes([]rune{'1', -1}) || m.Match([]string{"1", ".", "5", "15"}) {
+		t.Errorf("unknown symbols must fail")
+	}
+	classes := m.Classes()
+	if len(classes) != 4 || strings.Join(classes[1], "") != "+-" || strings.Join(classes[3], "") != "0123456789" {
+		t.Errorf("unexpected classes %v", classes)
+	}
+
+	enfa, _ := ParseRegex("(é|ab)+")
+	m = ToDFA(enfa).Compile()
+	if !m.MatchRunes([]rune("éabé")) || !m.Match(Makelist("abé")) || m.MatchRunes([]rune("a")) {
+		t.Errorf("runes not matched")
+	}
+
+	done := make(chan bool)
+	m = dfa.Compile()
+	for g := 0; g < 8; g++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				for _, c := range decimial_cases {
+					if m.MatchBytes([]byte(c.in)) != c.want {
+						t.Errorf("test for %s, expect %t", c.in, c.want)
+					}
+				}
+			}
+			done <- true
+		}()
+	}
+	for g := 0; g < 8; g++ {
+		<-done
+	}
+}
+
+func benchmarkInput() (*DFA, []string) {
+	dat, _ := ioutil.ReadFile("../resources/decimal.enfa")
+	dfa := ToDFA(eNFADeserialize(string(dat)))
+	return dfa, Makelist("-" + strings.Repeat("1234567890", 100) + "." + strings.Repeat("0987654321", 100))
+}
+
+func BenchmarkAccept(b *testing.B) {
+	dfa, in := benchmarkInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Accept(dfa, in)
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	dfa, in := benchmarkInput()
+	m := dfa.Compile()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Match(in)
+	}
+}
+
+func BenchmarkMatchBytes(b *testing.B) {
+	dfa, in := benchmarkInput()
+	m := dfa.Compile()
+	bytes := []byte(strings.Join(in, ""))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.MatchBytes(bytes)
+	}
+}
+
+// exponentialNFA generalizes resources/exponentialdfa.nfa: the k-th symbol
+// from the end is 1, which needs 2^k dfa states
+func exponentialNFA(k int) *NFA {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "q0\nq%d\nq0 0 q0\nq0 1 q0\nq0 1 q1\n", k)
+	for i := 1; i < k; i++ {
+		fmt.Fprintf(&sb, "q%d 0 q%d\nq%d 1 q%d\n", i, i+1, i, i+1)
+	}
+	return NFADeserialize(sb.String())
+}
+
+func benchmarkToDFA(b *testing.B, k int) {
+	nfa := exponentialNFA(k)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ToDFA(nfa)
+	}
+}
+
+func BenchmarkToDFA8(b *testing.B)  { benchmarkToDFA(b, 8) }
+func BenchmarkToDFA12(b *testing.B) { benchmarkToDFA(b, 12) }
+func BenchmarkToDFA16(b *testing.B) { benchmarkToDFA(b, 16) }
+
+func TestToDFASubsets(t *testing.T) {
+	nfa := exponentialNFA(10)
+	dfa := ToDFA(nfa)
+	if len(dfa.States) != 1024 {
+		t.Errorf("expect 1024 states, got %d", len(dfa.States))
+	}
+	for state, _ := range dfa.States { // named like Set.String()
+		s := NewSet()
+		for _, q := range strings.Split(state, ",") {
+			s.Insert(q)
+		}
+		if s.String() != state {
+			t.Errorf("bad state name %s", state)
+		}
+	}
+	if dfa.Start != "q0" || !dfa.Finish.Has("q0,q1,q10") {
+		t.Errorf("unexpected start %s or finish", dfa.Start)
+	}
+	in := Makelist("1101000000")
+	if !Accept(dfa, in) || Accept(dfa, in[1:]) {
+		t.Errorf("wrong language")
+	}
+}
+
+func TestToDFAWithOptions(t *testing.T) {
+	nfa := exponentialNFA(10)
+	calls := 0
+	dfa, stats, err := ToDFAWithOptions(context.Background(), nfa, ToDFAOptions{
+		Progress:         func(ToDFAStats) { calls++ },
+		ProgressInterval: 100,
+	})
+	if err != nil || len(dfa.States) != 1024 || stats.States != 1024 || stats.Expanded != 1024 || stats.Transitions != 2048 {
+		t.Errorf("unexpected result %v %+v", err, stats)
+	}
+	if calls != 10 {
+		t.Errorf("expect 10 progress calls, got %d", calls)
+	}
+	DFAequal(dfa, ToDFA(nfa), t)
+
+	dfa, stats, err = ToDFAWithOptions(context.Background(), exponentialNFA(30), ToDFAOptions{MaxStates: 500})
+	if dfa != nil || !errors.Is(err, ErrStateLimitExceeded) || stats.States <= 500 || stats.States > 502 {
+		t.Errorf("expect the limit to stop at 500 states, got %v %+v", err, stats)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, stats, err = ToDFAWithOptions(ctx, exponentialNFA(30), ToDFAOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) || stats.Expanded == 0 {
+		t.Errorf("expect a deadline error, got %v %+v", err, stats)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	_, _, err = ToDFAWithOptions(ctx, exponentialNFA(30), ToDFAOptions{
+		Progress: func(s ToDFAStats) { cancel() },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expect cancellation, got %v", err)
+	}
+}
+
+func TestLazyDFA(t *testing.T) {
+	nfa := exponentialNFA(10)
+	dfa := ToDFA(nfa)
+	rng := rand.New(rand.NewSource(1))
+	inputs := [][]string{{}, Makelist("2"), Makelist("1000000000"), Makelist("10000000000")}
+	for i := 0; i < 200; i++ {
+		input := make([]string, rng.Intn(40))
+		for j, _ := range input {
+			input[j] = string('0' + byte(rng.Intn(2)))
+		}
+		inputs = append(inputs, input)
+	}
+
+	lazy := NewLazyDFA(nfa, 2048)
+	if lazy.GetStart() != nfa.Start || len(lazy.TransTable()) != len(nfa.TransTable()) {
+		t.Errorf("expect the automata of the nfa")
+	}
+	for _, input := range inputs {
+		if Accept(lazy, input) != Accept(dfa, input) {
+			t.Errorf("lazy dfa disagrees on %v", input)
+		}
+	}
+	stats := lazy.Stats()
+	if stats.Evictions != 0 || stats.Fallbacks != 0 || lazy.Len() == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if Accept(lazy, Makelist("1000000000")) && lazy.Stats().Hits <= stats.Hits {
+		t.Errorf("expect the second run to hit the cache")
+	}
+
+	small := NewLazyDFA(nfa, 8)
+	for _, input := range inputs {
+		if Accept(small, input) != Accept(dfa, input) {
+			t.Errorf("small lazy dfa disagrees on %v", input)
+		}
+	}
+	if small.Len() > 8 || small.Stats().Evictions == 0 || small.Stats().Fallbacks == 0 {
+		t.Errorf("expect a thrashing cache, got %d states %+v", small.Len(), small.Stats())
+	}
+
+	small.SetStart("q1")
+	if small.Len() != 0 || !Accept(small, Makelist("000000000")) || Accept(small, Makelist("0000000000")) {
+		t.Errorf("SetStart q1 should accept exactly 9 symbols")
+	}
+
+	// the generic functions see the wrapped nfa, not the cache
+	enfa, err := ParseRegex("(a|b)*abb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy = NewLazyDFA(enfa, 4)
+	if ok, w := Equivalent(lazy, enfa); !ok {
+		t.Errorf("expect equivalent to the enfa, differ on %v", w)
+	}
+	empty, _ := IsEmpty(lazy)
+	universal, _ := IsUniversal(lazy, Makelist("ab"))
+	if _, finite := LanguageSize(lazy); empty || universal || finite || IsFinite(lazy) {
+		t.Errorf("unexpected properties of (a|b)*abb")
+	}
+	back, err := ParseRegex(ToRegex(lazy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := Equivalent(back, enfa); !ok {
+		t.Errorf("ToRegex %s is not (a|b)*abb", ToRegex(lazy))
+	}
+	if SerializeV2(lazy) != SerializeV2(enfa) || ToDOT(lazy) != ToDOT(enfa) {
+		t.Errorf("expect the formats of the enfa")
+	}
+	if !Explain(lazy, Makelist("babb")).Accepted() {
+		t.Errorf("expect Explain to accept babb")
+	}
+}
+
+func TestRunner(t *testing.T) {
+	enfa, err := ParseRegex("ab*c|a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, at := range []Automata{enfa, RemoveEpsilon(enfa), ToDFA(enfa), NewLazyDFA(enfa, 4)} {
+		r := NewRunner(at)
+		if r.Accepting() || r.Dead() {
+			t.Errorf("%T: expect a live non-accepting start", at)
+		}
+		if err := r.Step("a"); err != nil || !r.Accepting() {
+			t.Errorf("%T: expect a to be accepted, got %v", at, err)
+		}
+		snap := r.Snapshot()
+		for _, sb := range Makelist("bbb") {
+			if err := r.Step(sb); err != nil {
+				t.Errorf("%T: unexpected %v", at, err)
+			}
+		}
+		if r.Accepting() || r.Pos() != 4 {
+			t.Errorf("%T: abbb should not be accepted", at)
+		}
+		if err := r.Step("c"); err != nil || !r.Accepting() {
+			t.Errorf("%T: expect abbbc to be accepted, got %v", at, err)
+		}
+		if err := r.Step("c"); err != ErrStuck || !r.Dead() || r.Accepting() {
+			t.Errorf("%T: expect to get stuck on abbbcc, got %v", at, err)
+		}
+		if err := r.Step("a"); err != ErrStuck || r.Pos() != 6 {
+			t.Errorf("%T: expect to stay stuck, got %v at %d", at, err, r.Pos())
+		}
+		r.Restore(snap)
+		if r.Pos() != 1 || !r.Accepting() || r.Step("c") != nil || !r.Accepting() {
+			t.Errorf("%T: expect ac after restoring a", at)
+		}
+		r.Reset()
+		if r.Pos() != 0 || r.Step("b") != ErrStuck {
+			t.Errorf("%T: expect b to get stuck after reset", at)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	enfa, err := ParseRegex("ab|c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := Explain(enfa, Makelist("ab"))
+	if !trace.Accepted() || trace.Pos != 2 || len(trace.Steps) != 3 || !Accept(enfa, Makelist("ab")) {
+		t.Errorf("expect ab to be accepted:\n%s", trace)
+	}
+	if len(trace.Steps[0].States) != 3 || len(trace.Steps[0].Epsilon) != 2 || len(trace.Steps[1].Moves) != 1 {
+		t.Errorf("unexpected start step %+v", trace.Steps[0])
+	}
+
+	dfa := DFADeserialize("a\nc\na 0 b\nb 1 c\n")
+	trace = Explain(dfa, Makelist("010"))
+	expect := "0: {a}\n1 0: {b}  a -0-> b\n2 1: {c}  b -1-> c\nrejected: no transition for 0 at position 2 from {c}\n"
+	if trace.Result != TraceStuck || trace.Pos != 2 || trace.String() != expect {
+		t.Errorf("expect\n%s, got\n%s", expect, trace)
+	}
+	expect = `digraph trace {
+	rankdir=LR;
+	label="rejected: no transition for 0 at position 2 from {c}";
+	"0:a" [shape=circle, label="a"];
+	{rank=same; "0:a";}
+	"1:b" [shape=circle, label="b"];
+	{rank=same; "1:b";}
+	"0:a" -> "1:b" [label="0"];
+	"2:c" [shape=doublecircle, label="c"];
+	{rank=same; "2:c";}
+	"1:b" -> "2:c" [label="1"];
+	"3:stuck" [shape=box, label="no transition for 0"];
+	"2:c" -> "3:stuck" [style=dotted];
+}
+`
+	if trace.ToDOT() != expect {
+		t.Errorf("expect\n%s, got\n%s", expect, trace.ToDOT())
+	}
+
+	trace = Explain(NFADeserialize("a\nc\na 0 a\na 0 b\nb 1 c\n"), Makelist("00"))
+	if trace.Result != TraceNotFinal || trace.Reason() != "input ended in {a,b}, none of them final" {
+		t.Errorf("expect not final, got %v: %s", trace.Result, trace.Reason())
+	}
+	if len(trace.Steps[2].Moves) != 2 || trace.Steps[2].Moves[1] != (TraceEdge{"a", "b"}) {
+		t.Errorf("unexpected moves %v", trace.Steps[2].Moves)
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		regex, input string
+		expect       []Span
+	}{
+		{"ab*|b", "xabbbyb", []Span{{1, 5}, {6, 7}}},
+		{"a|ab", "ab", []Span{{0, 2}}},
+		{"a*", "baab", []Span{{0, 0}, {1, 3}, {4, 4}}},
+		{"[0-9]+", "x12y345", []Span{{1, 3}, {4, 7}}},
+		{"abc", "ababd", nil},
+	}
+	for _, test := range tests {
+		enfa, err := ParseRegex(test.regex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, at := range []Automata{enfa, RemoveEpsilon(enfa), Minimize(ToDFA(enfa))} {
+			spans := FindAllBytes(at, []byte(test.input))
+			if fmt.Sprint(spans) != fmt.Sprint(test.expect) {
+				t.Errorf("%T %s on %s: expect %v, got %v", at, test.regex, test.input, test.expect, spans)
+			}
+			span, ok := FindFirst(at, Makelist(test.input))
+			if ok != (len(test.expect) > 0) || ok && span != test.expect[0] {
+				t.Errorf("%T %s on %s: expect first %v, got %v", at, test.regex, test.input, test.expect, span)
+			}
+		}
+	}
+
+	// against brute force
+	enfa, _ := ParseRegex("(ab|b)*a|ba?b")
+	rng := rand.New(rand.NewSource(1))
+	for k := 0; k < 200; k++ {
+		input := make([]string, rng.Intn(12))
+		for i, _ := range input {
+			input[i] = string('a' + byte(rng.Intn(3)))
+		}
+		expect, found := Span{}, false
+		for i := 0; i <= len(input) && !found; i++ {
+			for j := len(input); j >= i; j-- {
+				if Accept(enfa, input[i:j]) {
+					expect, found = Span{i, j}, true
+					break
+				}
+			}
+		}
+		span, ok := FindFirst(enfa, input)
+		if ok != found || span != expect {
+			t.Errorf("on %v expect %v %v, got %v %v", input, expect, found, span, ok)
+		}
+		n, ok := FindLongestPrefix(enfa, input)
+		if ok != (found && expect.Start == 0) || ok && n != expect.End {
+			t.Errorf("on %v expect prefix %v, got %d %v", input, expect, n, ok)
+		}
+	}
+}
+
+func TestFindExponentialReverse(t *testing.T) {
+	// the unanchored reverse of (a|b){20}a has 2^20 dfa states
+	enfa, err := ParseRegex(strings.Repeat("(a|b)", 20) + "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(1))
+	symbols := make([]string, 3000)
+	for i, _ := range symbols {
+		symbols[i] = "b"
+		if rng.Intn(8) == 0 {
+			symbols[i] = "a"
+		}
+	}
+	var want []Span
+	for i := 0; i+21 <= len(symbols); i++ {
+		if symbols[i+20] == "a" && (len(want) == 0 || i >= want[len(want)-1].End) {
+			want = append(want, Span{i, i + 21})
+		}
+	}
+	if got := FindAll(enfa, symbols); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expect %v, got %v", want, got)
+	}
+}
+
+func TestLexer(t *testing.T) {
+	lt, _ := ParseRegex("<")
+	lx, err := NewLexer([]LexRule{
+		{Name: "space", Pattern: "[ \t\n]+"},
+		{Name: "if", Pattern: "if"},
+		{Name: "ident", Pattern: "[a-z][a-z0-9]*"},
+		{Name: "num", Pattern: "[0-9]+"},
+		{Name: "le", Pattern: "<="},
+		{Name: "lt", Automata: lt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := lx.Tokenize("if x1 <= 42\n ifx<")
+	var got []string
+	for _, token := range tokens {
+		got = append(got, fmt.Sprintf("%s %q %d:%d:%d", token.Name, token.Text, token.Pos.Offset, token.Pos.Line, token.Pos.Column))
+	}
+	expect := []string{
+		`if "if" 0:1:1`, `space " " 2:1:3`, `ident "x1" 3:1:4`, `space " " 5:1:6`,
+		`le "<=" 6:1:7`, `space " " 8:1:9`, `num "42" 9:1:10`, `space "\n " 11:1:12`,
+		`ident "ifx" 13:2:2`, `lt "<" 16:2:5`,
+	}
+	if err != nil || strings.Join(got, ", ") != strings.Join(expect, ", ") {
+		t.Errorf("expect %v, got %v %v", expect, got, err)
+	}
+
+	tokens, err = lx.Tokenize("a\n  é1")
+	var lexerr *LexError
+	if len(tokens) != 2 || !errors.As(err, &lexerr) || lexerr.Pos != (Position{4, 2, 3}) || lexerr.Char != 'é' {
+		t.Errorf("expect an error at 2:3, got %v %v", tokens, err)
+	}
+	if err != nil && err.Error() != "line 2, column 3: no token at 'é'" {
+		t.Errorf("unexpected message %s", err)
+	}
+
+	for state, state_obj := range lx.DFA().States {
+		if _, ok := state_obj.Attr[TokenAttr]; ok != lx.DFA().Finish.Has(state) {
+			t.Errorf("final state %s and its token disagree", state)
+		}
+	}
+	if _, err := NewLexer([]LexRule{{Name: "bad", Pattern: "(a"}}); err == nil || !strings.HasPrefix(err.Error(), "rule bad: ") {
+		t.Errorf("expect the rule in the error, got %v", err)
+	}
+}
+
+func TestAttr(t *testing.T) {
+	nfa := NFADeserialize("a\nc\na 0 a\na 0 b\nb 1 c\n")
+	nfa.States["a"].Attr["action"] = "shift"
+	nfa.States["b"].Attr["action"] = "reduce"
+	nfa.States["b"].Attr["rule"] = "1"
+	dfa := ToDFA(nfa)
+	attr := dfa.States["a,b"].Attr
+	if len(attr) != 2 || attr["action"] != "reduce,shift" || attr["rule"] != "1" {
+		t.Errorf("unexpected union %v", attr)
+	}
+	if len(dfa.States["c"].Attr) != 0 || dfa.States["a"].Attr["action"] != "shift" {
+		t.Errorf("unexpected attrs %v %v", dfa.States["c"].Attr, dfa.States["a"].Attr)
+	}
+	first, _, _ := ToDFAWithOptions(context.Background(), nfa, ToDFAOptions{MergeAttr: MergeAttrFirst})
+	if first.States["a,b"].Attr["action"] != "shift" {
+		t.Errorf("expect the first value, got %v", first.States["a,b"].Attr)
+	}
+
+	// 1 and 2 accept the same words, but only 2 and 3 have the same attrs
+	dfa = DFADeserialize("0\n1 2 3\n0 a 1\n0 b 2\n0 c 3\n")
+	dfa.States["1"] = NewDFAstate()
+	dfa.States["1"].Attr["token"] = "one"
+	for _, state := range []string{"2", "3"} {
+		dfa.States[state] = NewDFAstate()
+		dfa.States[state].Attr["token"] = "two"
+	}
+	min := Minimize(dfa)
+	if len(min.States) != 3 || min.States[min.States["q0"].Trans["a"]].Attr["token"] != "one" ||
+		min.States["q0"].Trans["b"] != min.States["q0"].Trans["c"] ||
+		min.States[min.States["q0"].Trans["c"]].Attr["token"] != "two" {
+		t.Errorf("unexpected minimal dfa %v", min.TransTable())
+	}
+	if ok, _ := Equivalent(min, dfa); !ok {
+		t.Errorf("minimize changed the language")
+	}
+
+	other := DFADeserialize("x\ny\nx a y\n")
+	other.States["y"] = NewDFAstate()
+	other.States["y"].Attr["token"] = "other"
+	both := Intersect(dfa, other)
+	if both.States["(1|y)"].Attr["token"] != "one,other" || both.States["(2|-)"].Attr["token"] != "two" || len(both.States["(0|x)"].Attr) != 0 {
+		t.Errorf("unexpected product attrs %v", both.States["(1|y)"].Attr)
+	}
+	pick := Product(dfa, other, func(f1, f2 bool) bool { return f1 || f2 }, MergeAttrFirst)
+	if pick.States["(1|y)"].Attr["token"] != "one" {
+		t.Errorf("expect the attr of dfa1, got %v", pick.States["(1|y)"].Attr)
+	}
+
+	nfa.States["b"].Attr["note"] = "two words"
+	for _, at := range []Automata{nfa, ToDFA(nfa), RemoveEpsilon(NeweNFA())} {
+		text := SerializeV2(at)
+		back, err := ParseV2(strings.NewReader(text))
+		if err != nil || SerializeV2(back) != text {
+			t.Errorf("%T does not round-trip: %v\n%s", at, err, text)
+		}
+		data, _ := json.Marshal(at)
+		back2, _ := json.Marshal(back)
+		if string(data) != string(back2) {
+			t.Errorf("%T json differs: %s %s", at, data, back2)
+		}
+	}
+	if !strings.Contains(SerializeV2(nfa), "attr: b note \"two words\"\n") {
+		t.Errorf("missing attr line in\n%s", SerializeV2(nfa))
+	}
+	_, err := ParseV2(strings.NewReader("automata v2 dfa\nstart: a\nattr: a key\n"))
+	if !errors.Is(err, ErrBadAttr) {
+		t.Errorf("expect ErrBadAttr, got %v", err)
+	}
+	_, err = ParseV2(strings.NewReader("automata v2 dfa\nstates: a\nstart: a\nattr: b key value\n"))
+	if !errors.Is(err, ErrUnknownState) {
+		t.Errorf("expect ErrUnknownState, got %v", err)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	enfa, err := ParseRegex("ab*c|d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enfa.States[enfa.Start].Attr["role"] = "start"
+	for _, at := range []Automata{enfa, RemoveEpsilon(enfa), ToDFA(enfa)} {
+		rev := Reverse(at)
+		for _, word := range []string{"", "ac", "abbc", "cbba", "ca", "d", "dd"} {
+			reversed := Makelist(word)
+			for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+				reversed[i], reversed[j] = reversed[j], reversed[i]
+			}
+			if Accept(rev, Makelist(word)) != Accept(at, reversed) {
+				t.Errorf("%T: reverse disagrees on %s", at, word)
+			}
+		}
+		if !rev.Finish.Has(at.GetStart()) || len(rev.Finish) != 1 || rev.Start != "^" {
+			t.Errorf("%T: unexpected start %s and finish %v", at, rev.Start, rev.Finish)
+		}
+		if len(rev.Symbols) != 4 {
+			t.Errorf("%T: expect the alphabet kept, got %v", at, rev.Symbols)
+		}
+	}
+	if Reverse(enfa).States[enfa.Start].Attr["role"] != "start" {
+		t.Errorf("expect the attr kept")
+	}
+	nfa := NFADeserialize("^\n^^\n^ a ^^\n")
+	if rev := Reverse(nfa); rev.Start != "^^^" || !Accept(rev, Makelist("a")) {
+		t.Errorf("expect a fresh start, got %s", rev.Start)
+	}
+
+	for _, regex := range []string{"ab*c|d", "(a|b)*abb", "(0|1(01*0)*1)*", "a*|b*", "(ab|a)(bc|c)"} {
+		enfa, _ := ParseRegex(regex)
+		DFAequal(BrzozowskiMinimize(enfa), Minimize(ToDFA(enfa)), t)
+	}
+	empty := DFADeserialize("a\n\na 0 b\n")
+	DFAequal(BrzozowskiMinimize(empty), Minimize(empty), t)
+	DFAequal(BrzozowskiMinimize(exponentialNFA(6)), Minimize(ToDFA(exponentialNFA(6))), t)
+}
+
+func TestToDFAMissingStates(t *testing.T) {
+	// z and w have no NFAstate
+	nfa := NewNFA()
+	nfa.Start = "a"
+	nfa.States["a"] = NewNFAstate("a")
+	nfa.States["a"].Trans["x"] = NewSet()
+	nfa.States["a"].Trans["x"].Insert("z")
+	nfa.Finish.Insert("z")
+	nfa.Finish.Insert("w")
+	dfa := ToDFA(nfa)
+	if !Accept(dfa, Makelist("x")) || Accept(dfa, Makelist("xx")) || len(dfa.States) != 2 {
+		t.Errorf("unexpected dfa %v", dfa.TransTable())
+	}
+
+	enfa := NeweNFA()
+	enfa.Start = "a"
+	enfa.States["a"] = NewNFAstate("a")
+	enfa.States["a"].Trans[epsilon] = NewSet()
+	enfa.States["a"].Trans[epsilon].Insert("b")
+	enfa.Finish.Insert("b")
+	if dfa := ToDFA(enfa); dfa.Start != "a,b" || !dfa.Finish.Has("a,b") {
+		t.Errorf("expect the closure a,b to be final, got %s %v", dfa.Start, dfa.Finish)
+	}
+}
@@ -0,0 +1,129 @@
+package automata
+
+import "sort"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// DFAMatcher is a DFA compiled for fast matching. States are numbered
+// densely, symbols behaving the same in every state share a class, and the
+// transitions are one flat table. It never changes after Compile, so any
+// number of goroutines may use it at once.
+type DFAMatcher struct {
+	nclass    int
+	table     []int // table[state*nclass+class], state 0 is dead
+	start     int
+	final     []bool
+	classes   map[string]int // symbol -> class, 0 for unknown symbols
+	byteclass [256]int       // class of the one byte symbols
+}
+
+func (dfa *DFA) Compile() *DFAMatcher {
+	alphabet := dfaAlphabet(dfa)
+
+	// number the reachable states, 0 is dead
+	index := map[string]int{dfa.Start: 1}
+	names := []string{"", dfa.Start}
+	for i := 1; i < len(names); i++ {
+		for _, sb := range alphabet {
+			dst := dfa.step(names[i], sb)
+			if _, ok := index[dst]; dst != "" && !ok {
+				index[dst] = len(names)
+				names = append(names, dst)
+			}
+		}
+	}
+
+	// symbols with the same column go to the same class, 0 is the dead column
+	m := &DFAMatcher{classes: make(map[string]int)}
+	column_class := map[string]int{strings.Repeat("0,", len(names)): 0}
+	var columns [][]int
+	columns = append(columns, make([]int, len(names)))
+	for _, sb := range alphabet {
+		column := make([]int, len(names))
+		var key strings.Builder
+		for i, name := range names {
+			if i > 0 {
+				column[i] = index[dfa.step(name, sb)]
+			}
+			key.WriteString(strconv.Itoa(column[i]) + ",")
+		}
+		class, ok := column_class[key.String()]
+		if !ok {
+			class = len(columns)
+			column_class[key.String()] = class
+			columns = append(columns, column)
+		}
+		m.classes[sb] = class
+		if len(sb) == 1 {
+			m.byteclass[sb[0]] = class
+		}
+	}
+
+	m.nclass = len(columns)
+	m.table = make([]int, len(names)*m.nclass)
+	for class, column := range columns {
+		for state, dst := range column {
+			m.table[state*m.nclass+class] = dst
+		}
+	}
+	m.start = 1
+	m.final = make([]bool, len(names))
+	for i, name := range names {
+		m.final[i] = i > 0 && dfa.Finish.Has(name)
+	}
+	return m
+}
+
+func (m *DFAMatcher) Match(symbols []string) bool {
+	state := m.start
+	for _, sb := range symbols {
+		state = m.table[state*m.nclass+m.classes[sb]]
+		if state == 0 {
+			return false
+		}
+	}
+	return m.final[state]
+}
+
+// MatchBytes takes every byte as a one byte symbol
+func (m *DFAMatcher) MatchBytes(b []byte) bool {
+	state := m.start
+	for _, c := range b {
+		state = m.table[state*m.nclass+m.byteclass[c]]
+		if state == 0 {
+			return false
+		}
+	}
+	return m.final[state]
+}
+
+// MatchRunes takes every rune as a symbol, like Makelist does
+func (m *DFAMatcher) MatchRunes(runes []rune) bool {
+	state := m.start
+	for _, r := range runes {
+		class := 0
+		if r >= 0 && r < utf8.RuneSelf {
+			class = m.byteclass[r]
+		} else {
+			class = m.classes[string(r)]
+		}
+		state = m.table[state*m.nclass+class]
+		if state == 0 {
+			return false
+		}
+	}
+	return m.final[state]
+}
+
+// Classes returns the symbols of each class, for inspection
+func (m *DFAMatcher) Classes() [][]string {
+	classes := make([][]string, m.nclass)
+	for sb, class := range m.classes {
+		classes[class] = append(classes[class], sb)
+	}
+	for _, symbols := range classes {
+		sort.Strings(symbols)
+	}
+	return classes
+}
@@ -0,0 +1,82 @@
+package automata
+
+func (dfa *DFA) Copy() *DFA {
+	newdfa := NewDFA()
+	newdfa.Start = dfa.Start
+	newdfa.Finish = dfa.Finish.Copy()
+	for sb, v := range dfa.Symbols {
+		newdfa.Symbols[sb] = v
+	}
+	for state, state_obj := range dfa.States {
+		s := NewDFAstate()
+		s.Id = state_obj.Id
+		for k, v := range state_obj.Attr {
+			s.Attr[k] = v
+		}
+		for sb, dst := range state_obj.Trans {
+			s.Trans[sb] = dst
+		}
+		newdfa.States[state] = s
+	}
+	return newdfa
+}
+
+// Complete returns a copy of the dfa with a transition for every symbol of
+// the alphabet in every state. The missing ones go to an added dead state.
+// Symbols already used by the dfa are kept in the alphabet, which is stored
+// in Symbols of the result.
+func Complete(dfa *DFA, alphabet []string) *DFA {
+	newdfa := dfa.Copy()
+	for _, sb := range alphabet {
+		newdfa.Symbols[sb] = nil
+	}
+	full := dfaAlphabet(newdfa)
+	for _, sb := range full {
+		newdfa.Symbols[sb] = nil
+	}
+
+	add_state := func(state string) {
+		if _, ok := newdfa.States[state]; !ok { // state may only apper in dst part
+			newdfa.States[state] = NewDFAstate()
+			newdfa.States[state].Id = state
+		}
+	}
+	add_state(newdfa.Start)
+	for _, state_obj := range dfa.States {
+		for _, dst := range state_obj.Trans {
+			add_state(dst)
+		}
+	}
+
+	dead := sinkName(dfa)
+	missing := false
+	for _, state_obj := range newdfa.States {
+		for _, sb := range full {
+			if _, ok := state_obj.Trans[sb]; !ok {
+				state_obj.Trans[sb] = dead
+				missing = true
+			}
+		}
+	}
+	if missing {
+		add_state(dead)
+		for _, sb := range full {
+			newdfa.States[dead].Trans[sb] = dead
+		}
+	}
+	return newdfa
+}
+
+// Complement returns the dfa accepting the words over the alphabet (plus the
+// symbols used by the dfa) that the dfa rejects
+func Complement(dfa *DFA, alphabet []string) *DFA {
+	newdfa := Complete(dfa, alphabet)
+	finish := NewSet()
+	for state, _ := range newdfa.States {
+		if !newdfa.Finish.Has(state) {
+			finish.Insert(state)
+		}
+	}
+	newdfa.Finish = finish
+	return newdfa
+}
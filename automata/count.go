@@ -0,0 +1,96 @@
+package automata
+
+import "math/big"
+import "math/rand"
+
+// CountByLength returns the number of words of each length 0..n accepted by
+// the dfa. Use ToDFA first to count the words of an nfa or eNFA: paths of an
+// nfa would count a word once per accepting run.
+func CountByLength(dfa *DFA, n int) []*big.Int {
+	alphabet := dfaAlphabet(dfa)
+	counts := make([]*big.Int, n+1)
+	ways := map[string]*big.Int{dfa.Start: big.NewInt(1)} // words of length k leading to the state
+	for k := 0; k <= n; k++ {
+		counts[k] = big.NewInt(0)
+		for state, w := range ways {
+			if dfa.Finish.Has(state) {
+				counts[k].Add(counts[k], w)
+			}
+		}
+		if k == n {
+			break
+		}
+		next := make(map[string]*big.Int)
+		for state, w := range ways {
+			for _, sb := range alphabet {
+				dst := dfa.step(state, sb)
+				if dst == "" {
+					continue
+				}
+				if _, ok := next[dst]; !ok {
+					next[dst] = big.NewInt(0)
+				}
+				next[dst].Add(next[dst], w)
+			}
+		}
+		ways = next
+	}
+	return counts
+}
+
+// SampleUniform draws one of the accepted words of length n, each with the
+// same probability. It returns false if the dfa accepts no such word.
+func SampleUniform(dfa *DFA, n int, rng *rand.Rand) ([]string, bool) {
+	alphabet := dfaAlphabet(dfa)
+	states := NewSet()
+	states.Insert(dfa.Start)
+	for state, state_obj := range dfa.States {
+		states.Insert(state)
+		for _, dst := range state_obj.Trans {
+			states.Insert(dst)
+		}
+	}
+
+	// accepting[k][state] = number of words of length k accepted from state
+	accepting := make([]map[string]*big.Int, n+1)
+	for k := 0; k <= n; k++ {
+		accepting[k] = make(map[string]*big.Int)
+		for state, _ := range states {
+			c := big.NewInt(0)
+			if k == 0 {
+				if dfa.Finish.Has(state) {
+					c.SetInt64(1)
+				}
+			} else {
+				for _, sb := range alphabet {
+					if dst := dfa.step(state, sb); dst != "" {
+						c.Add(c, accepting[k-1][dst])
+					}
+				}
+			}
+			accepting[k][state] = c
+		}
+	}
+	if accepting[n][dfa.Start].Sign() == 0 {
+		return nil, false
+	}
+
+	word := make([]string, 0, n)
+	state := dfa.Start
+	for k := n; k > 0; k-- {
+		r := new(big.Int).Rand(rng, accepting[k][state])
+		for _, sb := range alphabet {
+			dst := dfa.step(state, sb)
+			if dst == "" {
+				continue
+			}
+			if r.Cmp(accepting[k-1][dst]) < 0 {
+				word = append(word, sb)
+				state = dst
+				break
+			}
+			r.Sub(r, accepting[k-1][dst])
+		}
+	}
+	return word, true
+}
@@ -0,0 +1,127 @@
+package automata
+
+import "fmt"
+import "sort"
+import "strings"
+
+func dotQuote(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return "\"" + s + "\""
+}
+
+// ToDOT renders the automata in graphviz DOT. Finish states are double
+// circles, the start state gets an arrow from a point, parallel transitions
+// share one edge labelled with all their symbols and epsilon shows as ε.
+// Everything is sorted, so the same automata always gives the same text.
+func ToDOT(at Automata) string {
+	at = unwrap(at)
+	_, is_enfa := at.(*eNFA)
+	states := NewSet()
+	states.Insert(at.GetStart())
+	for f, _ := range at.GetFinish() {
+		states.Insert(f)
+	}
+	switch a := at.(type) {
+	case *DFA:
+		for state, _ := range a.States {
+			states.Insert(state)
+		}
+	case NFAAutomata:
+		for state, _ := range a.GetStates() {
+			states.Insert(state)
+		}
+	}
+	labels := make(map[[2]string][]string) // labels[from, to] = symbols
+	for _, record := range at.TransTable() {
+		states.Insert(record[0])
+		states.Insert(record[2])
+		sb := record[1]
+		if is_enfa && sb == epsilon {
+			sb = "ε"
+		}
+		edge := [2]string{record[0], record[2]}
+		labels[edge] = append(labels[edge], sb)
+	}
+
+	var sorted_states []string
+	for state, _ := range states {
+		sorted_states = append(sorted_states, state)
+	}
+	sort.Strings(sorted_states)
+	var edges [][2]string
+	for edge, _ := range labels {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+	start := "__start"
+	for states.Has(start) {
+		start += "_"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph automata {\n")
+	fmt.Fprintf(&sb, "\trankdir=LR;\n")
+	fmt.Fprintf(&sb, "\t%s [shape=point];\n", dotQuote(start))
+	for _, state := range sorted_states {
+		shape := "circle"
+		if at.GetFinish().Has(state) {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(&sb, "\t%s [shape=%s];\n", dotQuote(state), shape)
+	}
+	fmt.Fprintf(&sb, "\t%s -> %s;\n", dotQuote(start), dotQuote(at.GetStart()))
+	for _, edge := range edges {
+		symbols := labels[edge]
+		sort.Strings(symbols)
+		fmt.Fprintf(&sb, "\t%s -> %s [label=%s];\n", dotQuote(edge[0]), dotQuote(edge[1]), dotQuote(strings.Join(symbols, ",")))
+	}
+	fmt.Fprintf(&sb, "}\n")
+	return sb.String()
+}
+
+// ToDOT renders the dependency graph of the variables: an edge from A to B
+// when B appears in a production of A. The start variable is a double
+// circle and terminals are left out.
+func (cfg *CFG) ToDOT() string {
+	var vars []string
+	for var_str, _ := range cfg.Variables {
+		vars = append(vars, var_str)
+	}
+	sort.Strings(vars)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph cfg {\n")
+	for _, var_str := range vars {
+		shape := "circle"
+		if var_str == cfg.Start {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(&sb, "\t%s [shape=%s];\n", dotQuote(var_str), shape)
+	}
+	for _, var_str := range vars {
+		dsts := NewSet()
+		for _, product := range cfg.Variables[var_str].Productions {
+			for _, symbol := range product {
+				if v, ok := symbol.(*Variable); ok {
+					dsts.Insert(v.Id)
+				}
+			}
+		}
+		var sorted_dsts []string
+		for dst, _ := range dsts {
+			sorted_dsts = append(sorted_dsts, dst)
+		}
+		sort.Strings(sorted_dsts)
+		for _, dst := range sorted_dsts {
+			fmt.Fprintf(&sb, "\t%s -> %s;\n", dotQuote(var_str), dotQuote(dst))
+		}
+	}
+	fmt.Fprintf(&sb, "}\n")
+	return sb.String()
+}
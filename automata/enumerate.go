@@ -0,0 +1,158 @@
+package automata
+
+import "context"
+import "sort"
+import "strconv"
+
+// Enumerate sends the accepted words of at most maxLen symbols in shortlex
+// order, shorter words first and words of the same length sorted. A negative
+// maxLen means no limit. The words are produced lazily, so infinite
+// languages are fine: stop reading by cancelling ctx. The channel is closed
+// when every word has been sent or ctx is done.
+func Enumerate(ctx context.Context, at Automata, maxLen int) <-chan []string {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		e := newEnumerator(at)
+		frontier := []Set{startStates(at)} // live state sets reached by l symbols
+		for l := 0; maxLen < 0 || l <= maxLen; l++ {
+			var live []Set
+			for _, states := range frontier {
+				if e.live(states) {
+					live = append(live, states)
+				}
+			}
+			if len(live) == 0 { // no longer word can be accepted
+				return
+			}
+			if !e.dfs(ctx, ch, startStates(at), []string{}, l) {
+				return
+			}
+			frontier = e.step(live)
+		}
+	}()
+	return ch
+}
+
+type enumerator struct {
+	at      Automata
+	symbols []string
+	alive   Set             // states able to reach a finish state
+	accepts map[string]bool // state set and length -> accepts a word of that length
+}
+
+func newEnumerator(at Automata) *enumerator {
+	e := &enumerator{at: at, accepts: make(map[string]bool)}
+	graph := transGraph(at)
+	s := NewSet()
+	reverse := make(map[string][]string)
+	for from, edges := range graph {
+		for _, edge := range edges {
+			reverse[edge.to] = append(reverse[edge.to], from)
+			if edge.symbol != "" {
+				s.Insert(edge.symbol)
+			}
+		}
+	}
+	for sb, _ := range s {
+		e.symbols = append(e.symbols, sb)
+	}
+	sort.Strings(e.symbols)
+
+	e.alive = NewSet()
+	var stack []string
+	for f, _ := range at.GetFinish() {
+		e.alive.Insert(f)
+		stack = append(stack, f)
+	}
+	for len(stack) > 0 {
+		state := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, src := range reverse[state] {
+			if !e.alive.Has(src) {
+				e.alive.Insert(src)
+				stack = append(stack, src)
+			}
+		}
+	}
+	return e
+}
+
+func (e *enumerator) live(states Set) bool {
+	for state, _ := range states {
+		if e.alive.Has(state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *enumerator) step(frontier []Set) []Set {
+	seen := NewSet()
+	var next []Set
+	for _, states := range frontier {
+		for _, sb := range e.symbols {
+			dsts := nextStates(e.at, states, sb)
+			if e.live(dsts) && !seen.Has(dsts.String()) {
+				seen.Insert(dsts.String())
+				next = append(next, dsts)
+			}
+		}
+	}
+	return next
+}
+
+// acceptsIn tells whether some word of exactly n symbols leads from the
+// states to a finish state
+func (e *enumerator) acceptsIn(states Set, n int) bool {
+	if n == 0 {
+		for state, _ := range states {
+			if e.at.GetFinish().Has(state) {
+				return true
+			}
+		}
+		return false
+	}
+	key := states.String() + ";" + strconv.Itoa(n)
+	if ok, seen := e.accepts[key]; seen {
+		return ok
+	}
+	ok := false
+	for _, sb := range e.symbols {
+		dsts := nextStates(e.at, states, sb)
+		if e.live(dsts) && e.acceptsIn(dsts, n-1) {
+			ok = true
+			break
+		}
+	}
+	e.accepts[key] = ok
+	return ok
+}
+
+// dfs sends the accepted words of length len(prefix)+n starting with prefix,
+// it returns false once ctx is done
+func (e *enumerator) dfs(ctx context.Context, ch chan<- []string, states Set, prefix []string, n int) bool {
+	if !e.acceptsIn(states, n) {
+		return true
+	}
+	if n == 0 {
+		word := make([]string, len(prefix))
+		copy(word, prefix)
+		select {
+		case ch <- word:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for _, sb := range e.symbols {
+		dsts := nextStates(e.at, states, sb)
+		if !e.live(dsts) {
+			continue
+		}
+		if !e.dfs(ctx, ch, dsts, append(prefix, sb), n-1) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package automata
+
+// RemoveEpsilon returns an NFA accepting the same language without epsilon
+// moves and with the same state ids. A state gets the moves of every state
+// in its closure, and is final when its closure holds a final state.
+func RemoveEpsilon(enfa *eNFA) *NFA {
+	nfa := NewNFA()
+	nfa.Start = enfa.Start
+	for sb, v := range enfa.Symbols {
+		if sb != epsilon {
+			nfa.Symbols[sb] = v
+		}
+	}
+	for state, state_obj := range enfa.States {
+		s := NewNFAstate(state)
+		for k, v := range state_obj.Attr {
+			s.Attr[k] = v
+		}
+		nfa.States[state] = s
+	}
+	for state, _ := range enfa.States {
+		for q, _ := range enfa.closure(state) {
+			if enfa.Finish.Has(q) {
+				nfa.Finish.Insert(state)
+			}
+			q_obj, ok := enfa.States[q]
+			if !ok {
+				continue
+			}
+			for sb, dsts := range q_obj.Trans {
+				if sb == epsilon {
+					continue
+				}
+				for dst, _ := range dsts {
+					nfa.addTrans(state, sb, dst)
+				}
+			}
+		}
+	}
+	for f, _ := range enfa.Finish { // finish states may have no state object
+		nfa.Finish.Insert(f)
+	}
+	return nfa
+}
@@ -0,0 +1,61 @@
+package automata
+
+import "github.com/golang-collections/go-datastructures/queue"
+
+// determinize returns the dfa itself or the subset construction of an nfa
+func determinize(at Automata) *DFA {
+	switch a := unwrap(at).(type) {
+	case *DFA:
+		return a
+	case NFAAutomata:
+		return ToDFA(a)
+	default:
+		panic("Unknown automata type")
+	}
+}
+
+// Equivalent tells whether a and b accept the same language. If not, it also
+// returns the shortest word accepted by exactly one of them, the smallest in
+// symbol order among those of that length.
+func Equivalent(a, b Automata) (bool, []string) {
+	dfa1 := determinize(a)
+	dfa2 := determinize(b)
+
+	alphabet := dfaAlphabet(dfa1, dfa2)
+
+	// BFS over pairs of states, "" being the missing dead state
+	type pair struct {
+		s1, s2 string
+	}
+	type node struct {
+		p    pair
+		word []string
+	}
+	isfinal := func(dfa *DFA, state string) bool {
+		return state != "" && dfa.Finish.Has(state)
+	}
+	visited := make(map[pair]bool)
+	start := pair{dfa1.Start, dfa2.Start}
+	visited[start] = true
+	q := queue.New(10)
+	q.Put(node{start, []string{}})
+	for !q.Empty() {
+		_n, _ := q.Get(1)
+		n := _n[0].(node)
+		if isfinal(dfa1, n.p.s1) != isfinal(dfa2, n.p.s2) {
+			return false, n.word
+		}
+		for _, sb := range alphabet {
+			p := pair{dfa1.step(n.p.s1, sb), dfa2.step(n.p.s2, sb)}
+			if p.s1 == "" && p.s2 == "" || visited[p] {
+				continue
+			}
+			visited[p] = true
+			word := make([]string, len(n.word)+1)
+			copy(word, n.word)
+			word[len(n.word)] = sb
+			q.Put(node{p, word})
+		}
+	}
+	return true, nil
+}
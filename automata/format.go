@@ -0,0 +1,382 @@
+package automata
+
+import "errors"
+import "fmt"
+import "io"
+import "sort"
+import "strconv"
+import "strings"
+import "unicode"
+
+// Version 2 of the text format. Unlike the one of Serialize it keeps the
+// alphabet and the isolated states, and allows any symbol:
+//
+//	automata v2 enfa
+//	# comments run to the end of the line
+//	alphabet: 0 1 "two words"
+//	states: q0 q1 q2
+//	start: q0
+//	final: q2
+//	attr: q2 token number
+//	q0 epsilon q1
+//	q1 "two words" q2
+//
+// The header says dfa, nfa or enfa. Tokens are separated by spaces or tabs
+// and may be quoted with Go string syntax. In an enfa the symbol epsilon is
+// the epsilon move. The alphabet and states lines are optional, but once
+// given every symbol or state used must be declared in them. Each attr line
+// sets one key of the Attr of a state, so unlike the others it may repeat.
+var (
+	ErrBadHeader          = errors.New("expect \"automata v2 dfa|nfa|enfa\"")
+	ErrDuplicateDirective = errors.New("directive given twice")
+	ErrMissingStart       = errors.New("no start: line")
+	ErrUnknownSymbol      = errors.New("symbol not in the alphabet: line")
+	ErrUnknownState       = errors.New("state not in the states: line")
+	ErrBadAttr            = errors.New("expect \"attr: state key value\"")
+)
+
+const formatVersion = "v2"
+
+// formatToken quotes the token when it would not read back as one bare word
+func formatToken(s string) string {
+	if s == "" || strings.HasSuffix(s, ":") || strings.IndexFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"' || r == '#' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatTokens(tokens []string) string {
+	quoted := make([]string, len(tokens))
+	for i, t := range tokens {
+		quoted[i] = formatToken(t)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func SerializeV2(at Automata) string {
+	kind := ""
+	states := NewSet()
+	symbols := NewSet()
+	attrs := make(map[string]map[string]string)
+	var nfa *NFA
+	at = unwrap(at)
+	switch a := at.(type) {
+	case *DFA:
+		kind = "dfa"
+		for state, state_obj := range a.States {
+			states.Insert(state)
+			attrs[state] = state_obj.Attr
+		}
+		for sb, _ := range a.Symbols {
+			symbols.Insert(sb)
+		}
+	case *NFA:
+		kind = "nfa"
+		nfa = a
+	case *eNFA:
+		kind = "enfa"
+		nfa = &a.NFA
+	default:
+		panic("Unknown automata type")
+	}
+	if nfa != nil {
+		for state, state_obj := range nfa.States {
+			states.Insert(state)
+			attrs[state] = state_obj.Attr
+		}
+		for sb, _ := range nfa.Symbols {
+			symbols.Insert(sb)
+		}
+	}
+	_, is_enfa := at.(*eNFA)
+	states.Insert(at.GetStart())
+	for f, _ := range at.GetFinish() {
+		states.Insert(f)
+	}
+	trans_table := at.TransTable()
+	for _, record := range trans_table {
+		states.Insert(record[0])
+		states.Insert(record[2])
+		if !(is_enfa && record[1] == epsilon) {
+			symbols.Insert(record[1])
+		}
+	}
+	sorted := func(s Set) []string {
+		var l []string
+		for v, _ := range s {
+			l = append(l, v)
+		}
+		sort.Strings(l)
+		return l
+	}
+	sort.Slice(trans_table, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if trans_table[i][k] != trans_table[j][k] {
+				return trans_table[i][k] < trans_table[j][k]
+			}
+		}
+		return false
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "automata %s %s\n", formatVersion, kind)
+	fmt.Fprintf(&sb, "alphabet: %s\n", formatTokens(sorted(symbols)))
+	fmt.Fprintf(&sb, "states: %s\n", formatTokens(sorted(states)))
+	fmt.Fprintf(&sb, "start: %s\n", formatToken(at.GetStart()))
+	fmt.Fprintf(&sb, "final: %s\n", formatTokens(sorted(at.GetFinish())))
+	for _, state := range sorted(states) {
+		attr := attrs[state]
+		var keys []string
+		for k, _ := range attr {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "attr: %s\n", formatTokens([]string{state, k, attr[k]}))
+		}
+	}
+	for _, record := range trans_table {
+		if is_enfa && record[1] == epsilon {
+			fmt.Fprintf(&sb, "%s %s %s\n", formatToken(record[0]), epsilon, formatToken(record[2]))
+		} else {
+			fmt.Fprintf(&sb, "%s\n", formatTokens(record))
+		}
+	}
+	return sb.String()
+}
+
+// tokenizeV2 splits a line into tokens, dropping the comment. quoted tells
+// which tokens were quoted, so a quoted "start:" is not a directive.
+func tokenizeV2(line string, lineno int) ([]field, []bool, error) {
+	var fields []field
+	var quoted []bool
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		if c == ' ' || c == '\t' || c == '\r' {
+			i++
+			continue
+		}
+		if c == '#' {
+			break
+		}
+		start := i
+		if c == '"' {
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, nil, &ParseError{lineno, start + 1, ErrUnterminatedQuote}
+			}
+			i++
+			s, err := strconv.Unquote(string(runes[start:i]))
+			if err != nil {
+				return nil, nil, &ParseError{lineno, start + 1, err}
+			}
+			fields = append(fields, field{s, start + 1})
+			quoted = append(quoted, true)
+			continue
+		}
+		for i < len(runes) && runes[i] != ' ' && runes[i] != '\t' && runes[i] != '\r' && runes[i] != '#' {
+			i++
+		}
+		fields = append(fields, field{string(runes[start:i]), start + 1})
+		quoted = append(quoted, false)
+	}
+	return fields, quoted, nil
+}
+
+// ParseV2 reads the version 2 format and returns a *DFA, *NFA or *eNFA as
+// named in the header
+func ParseV2(r io.Reader) (Automata, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var at Automata
+	var dfa *DFA
+	var nfa *NFA
+	is_enfa := false
+	var symbols Set              // declared alphabet, nil if none
+	var states Set               // declared states, nil if none
+	seen := make(map[string]int) // directive -> line
+	type transition struct {
+		from, symbol, to field
+		lineno           int
+	}
+	var transitions []transition
+	type attribute struct {
+		state      field
+		key, value string
+		lineno     int
+	}
+	var attributes []attribute
+
+	for i, line := range lines {
+		lineno := i + 1
+		fields, quoted, err := tokenizeV2(line, lineno)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if at == nil { // the header
+			if len(fields) != 3 || fields[0].text != "automata" || fields[1].text != formatVersion {
+				return nil, &ParseError{lineno, 0, ErrBadHeader}
+			}
+			switch fields[2].text {
+			case "dfa":
+				dfa = NewDFA()
+				at = dfa
+			case "nfa":
+				nfa = NewNFA()
+				at = nfa
+			case "enfa":
+				enfa := NeweNFA()
+				nfa = &enfa.NFA
+				at = enfa
+				is_enfa = true
+			default:
+				return nil, &ParseError{lineno, fields[2].column, ErrBadHeader}
+			}
+			continue
+		}
+
+		directive := fields[0].text
+		if quoted[0] || !strings.HasSuffix(directive, ":") {
+			if len(fields) != 3 {
+				return nil, &ParseError{lineno, 0, ErrFieldCount}
+			}
+			transitions = append(transitions, transition{fields[0], fields[1], fields[2], lineno})
+			continue
+		}
+		if directive == "attr:" {
+			if len(fields) != 4 {
+				return nil, &ParseError{lineno, 0, ErrBadAttr}
+			}
+			attributes = append(attributes, attribute{fields[1], fields[2].text, fields[3].text, lineno})
+			continue
+		}
+		if _, ok := seen[directive]; ok {
+			return nil, &ParseError{lineno, fields[0].column, ErrDuplicateDirective}
+		}
+		seen[directive] = lineno
+		values := NewSet()
+		for _, f := range fields[1:] {
+			values.Insert(f.text)
+		}
+		switch directive {
+		case "alphabet:":
+			symbols = values
+		case "states:":
+			states = values
+		case "start:":
+			if len(fields) != 2 {
+				return nil, &ParseError{lineno, 0, ErrBadStart}
+			}
+			at.SetStart(fields[1].text)
+		case "final:":
+			for f, _ := range values {
+				at.GetFinish().Insert(f)
+			}
+		default:
+			return nil, &ParseError{lineno, fields[0].column, fmt.Errorf("unknown directive %s", directive)}
+		}
+	}
+	if at == nil {
+		return nil, &ParseError{len(lines) + 1, 0, ErrBadHeader}
+	}
+	if _, ok := seen["start:"]; !ok {
+		return nil, &ParseError{len(lines) + 1, 0, ErrMissingStart}
+	}
+
+	check_state := func(f field, lineno int) error {
+		if states != nil && !states.Has(f.text) {
+			return &ParseError{lineno, f.column, ErrUnknownState}
+		}
+		return nil
+	}
+	if err := check_state(field{at.GetStart(), 0}, seen["start:"]); err != nil {
+		return nil, err
+	}
+	for f, _ := range at.GetFinish() {
+		if err := check_state(field{f, 0}, seen["final:"]); err != nil {
+			return nil, err
+		}
+	}
+	for state, _ := range states {
+		if dfa != nil {
+			dfa.States[state] = NewDFAstate()
+			dfa.States[state].Id = state
+		} else {
+			nfa.States[state] = NewNFAstate(state)
+		}
+	}
+	for sb, _ := range symbols {
+		if dfa != nil {
+			dfa.Symbols[sb] = nil
+		} else {
+			nfa.Symbols[sb] = nil
+		}
+	}
+
+	for _, t := range transitions {
+		for _, f := range []field{t.from, t.to} {
+			if err := check_state(f, t.lineno); err != nil {
+				return nil, err
+			}
+		}
+		move := is_enfa && t.symbol.text == epsilon
+		if !move && symbols != nil && !symbols.Has(t.symbol.text) {
+			return nil, &ParseError{t.lineno, t.symbol.column, ErrUnknownSymbol}
+		}
+		if dfa == nil {
+			nfa.addTrans(t.from.text, t.symbol.text, t.to.text)
+			if !move {
+				nfa.Symbols[t.symbol.text] = nil
+			}
+			continue
+		}
+		for _, state := range []string{t.from.text, t.to.text} {
+			if _, ok := dfa.States[state]; !ok {
+				dfa.States[state] = NewDFAstate()
+				dfa.States[state].Id = state
+			}
+		}
+		dst, ok := dfa.States[t.from.text].Trans[t.symbol.text]
+		if ok && dst != t.to.text {
+			return nil, &ParseError{t.lineno, t.symbol.column, ErrNondeterministic}
+		}
+		dfa.States[t.from.text].Trans[t.symbol.text] = t.to.text
+		dfa.Symbols[t.symbol.text] = nil
+	}
+
+	for _, a := range attributes {
+		if err := check_state(a.state, a.lineno); err != nil {
+			return nil, err
+		}
+		var attr map[string]string
+		if dfa != nil {
+			if _, ok := dfa.States[a.state.text]; !ok {
+				dfa.States[a.state.text] = NewDFAstate()
+				dfa.States[a.state.text].Id = a.state.text
+			}
+			attr = dfa.States[a.state.text].Attr
+		} else {
+			if _, ok := nfa.States[a.state.text]; !ok {
+				nfa.States[a.state.text] = NewNFAstate(a.state.text)
+			}
+			attr = nfa.States[a.state.text].Attr
+		}
+		attr[a.key] = a.value
+	}
+	return at, nil
+}
@@ -0,0 +1,317 @@
+package automata
+
+import "encoding/json"
+import "fmt"
+import "sort"
+
+// JSON schema of DFA, NFA and eNFA, everything sorted:
+//
+//	{
+//	  "type": "dfa" | "nfa" | "enfa",
+//	  "alphabet": ["0", "1"],
+//	  "start": "q0",
+//	  "final": ["q2"],
+//	  "states": [{"id": "q0", "attr": {"key": "value"}}, ...],
+//	  "transitions": [{"from": "q0", "symbol": "0", "to": "q1"},
+//	                  {"from": "q1", "epsilon": true, "to": "q2"}, ...]
+//	}
+//
+// attr is left out when empty, epsilon is only used by enfa.
+//
+// JSON schema of CFG, variables sorted by id:
+//
+//	{
+//	  "start": "S",
+//	  "variables": [{"id": "S", "productions": [
+//	    [{"type": "terminal", "value": "0"}, {"type": "variable", "value": "S"}],
+//	    ...]}, ...]
+//	}
+type jsonAutomata struct {
+	Type        string           `json:"type"`
+	Alphabet    []string         `json:"alphabet"`
+	Start       string           `json:"start"`
+	Final       []string         `json:"final"`
+	States      []jsonState      `json:"states"`
+	Transitions []jsonTransition `json:"transitions"`
+}
+
+type jsonState struct {
+	Id   string            `json:"id"`
+	Attr map[string]string `json:"attr,omitempty"`
+}
+
+type jsonTransition struct {
+	From    string `json:"from"`
+	Symbol  string `json:"symbol,omitempty"`
+	Epsilon bool   `json:"epsilon,omitempty"`
+	To      string `json:"to"`
+}
+
+type jsonCFG struct {
+	Start     string         `json:"start"`
+	Variables []jsonVariable `json:"variables"`
+}
+
+type jsonVariable struct {
+	Id          string         `json:"id"`
+	Productions [][]jsonSymbol `json:"productions"`
+}
+
+type jsonSymbol struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func sortedKeys(s Set) []string {
+	keys := []string{}
+	for k, _ := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toJSONAutomata fills everything but the states
+func toJSONAutomata(kind string, at Automata, symbols map[string]interface{}) *jsonAutomata {
+	_, is_enfa := at.(*eNFA)
+	alphabet := NewSet()
+	for sb, _ := range symbols {
+		alphabet.Insert(sb)
+	}
+	j := &jsonAutomata{Type: kind, Start: at.GetStart(), Final: sortedKeys(at.GetFinish())}
+	j.Transitions = []jsonTransition{}
+	for _, record := range at.TransTable() {
+		if is_enfa && record[1] == epsilon {
+			j.Transitions = append(j.Transitions, jsonTransition{From: record[0], Epsilon: true, To: record[2]})
+			continue
+		}
+		alphabet.Insert(record[1])
+		j.Transitions = append(j.Transitions, jsonTransition{From: record[0], Symbol: record[1], To: record[2]})
+	}
+	sort.Slice(j.Transitions, func(a, b int) bool {
+		ta, tb := j.Transitions[a], j.Transitions[b]
+		if ta.From != tb.From {
+			return ta.From < tb.From
+		}
+		if ta.Epsilon != tb.Epsilon {
+			return ta.Epsilon
+		}
+		if ta.Symbol != tb.Symbol {
+			return ta.Symbol < tb.Symbol
+		}
+		return ta.To < tb.To
+	})
+	j.Alphabet = sortedKeys(alphabet)
+	return j
+}
+
+func (j *jsonAutomata) addState(id string, attr map[string]string) {
+	s := jsonState{Id: id}
+	if len(attr) > 0 {
+		s.Attr = attr
+	}
+	j.States = append(j.States, s)
+}
+
+func (j *jsonAutomata) sortStates() {
+	sort.Slice(j.States, func(a, b int) bool { return j.States[a].Id < j.States[b].Id })
+}
+
+func (dfa *DFA) MarshalJSON() ([]byte, error) {
+	j := toJSONAutomata("dfa", dfa, dfa.Symbols)
+	states := NewSet()
+	for state, state_obj := range dfa.States {
+		j.addState(state, state_obj.Attr)
+		states.Insert(state)
+	}
+	for _, t := range j.Transitions { // states that only apper in dst part
+		if !states.Has(t.To) {
+			states.Insert(t.To)
+			j.addState(t.To, nil)
+		}
+	}
+	if !states.Has(dfa.Start) {
+		j.addState(dfa.Start, nil)
+	}
+	j.sortStates()
+	return json.Marshal(j)
+}
+
+func (nfa *NFA) marshalJSON(kind string, at Automata) ([]byte, error) {
+	j := toJSONAutomata(kind, at, nfa.Symbols)
+	for state, state_obj := range nfa.States {
+		j.addState(state, state_obj.Attr)
+	}
+	if _, ok := nfa.States[nfa.Start]; !ok {
+		j.addState(nfa.Start, nil)
+	}
+	j.sortStates()
+	return json.Marshal(j)
+}
+
+func (nfa *NFA) MarshalJSON() ([]byte, error) {
+	return nfa.marshalJSON("nfa", nfa)
+}
+
+func (enfa *eNFA) MarshalJSON() ([]byte, error) {
+	return enfa.NFA.marshalJSON("enfa", enfa)
+}
+
+func readJSONAutomata(data []byte, kind string) (*jsonAutomata, error) {
+	var j jsonAutomata
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	if j.Type != kind {
+		return nil, fmt.Errorf("automata json: type %q, expect %q", j.Type, kind)
+	}
+	for _, t := range j.Transitions {
+		if t.Epsilon && kind != "enfa" {
+			return nil, fmt.Errorf("automata json: epsilon transition from %s in a %s", t.From, kind)
+		}
+	}
+	return &j, nil
+}
+
+func (dfa *DFA) UnmarshalJSON(data []byte) error {
+	j, err := readJSONAutomata(data, "dfa")
+	if err != nil {
+		return err
+	}
+	newdfa := NewDFA()
+	newdfa.Start = j.Start
+	for _, f := range j.Final {
+		newdfa.Finish.Insert(f)
+	}
+	for _, sb := range j.Alphabet {
+		newdfa.Symbols[sb] = nil
+	}
+	add_state := func(state string) *DFAstate {
+		if _, ok := newdfa.States[state]; !ok {
+			newdfa.States[state] = NewDFAstate()
+			newdfa.States[state].Id = state
+		}
+		return newdfa.States[state]
+	}
+	for _, s := range j.States {
+		state_obj := add_state(s.Id)
+		for k, v := range s.Attr {
+			state_obj.Attr[k] = v
+		}
+	}
+	for _, t := range j.Transitions {
+		add_state(t.To)
+		state_obj := add_state(t.From)
+		if dst, ok := state_obj.Trans[t.Symbol]; ok && dst != t.To {
+			return fmt.Errorf("automata json: %s has two transitions for %q in a dfa", t.From, t.Symbol)
+		}
+		state_obj.Trans[t.Symbol] = t.To
+		newdfa.Symbols[t.Symbol] = nil
+	}
+	*dfa = *newdfa
+	return nil
+}
+
+func (nfa *NFA) unmarshalJSON(data []byte, kind string) error {
+	j, err := readJSONAutomata(data, kind)
+	if err != nil {
+		return err
+	}
+	newnfa := NewNFA()
+	newnfa.Start = j.Start
+	for _, f := range j.Final {
+		newnfa.Finish.Insert(f)
+	}
+	for _, sb := range j.Alphabet {
+		newnfa.Symbols[sb] = nil
+	}
+	for _, s := range j.States {
+		if _, ok := newnfa.States[s.Id]; !ok {
+			newnfa.States[s.Id] = NewNFAstate(s.Id)
+		}
+		for k, v := range s.Attr {
+			newnfa.States[s.Id].Attr[k] = v
+		}
+	}
+	for _, t := range j.Transitions {
+		if t.Epsilon {
+			newnfa.addTrans(t.From, epsilon, t.To)
+			continue
+		}
+		newnfa.addTrans(t.From, t.Symbol, t.To)
+		newnfa.Symbols[t.Symbol] = nil
+	}
+	*nfa = *newnfa
+	return nil
+}
+
+func (nfa *NFA) UnmarshalJSON(data []byte) error {
+	return nfa.unmarshalJSON(data, "nfa")
+}
+
+func (enfa *eNFA) UnmarshalJSON(data []byte) error {
+	enfa.InvalidateEclose()
+	return enfa.NFA.unmarshalJSON(data, "enfa")
+}
+
+func (cfg *CFG) MarshalJSON() ([]byte, error) {
+	j := jsonCFG{Start: cfg.Start, Variables: []jsonVariable{}}
+	var vars []string
+	for var_str, _ := range cfg.Variables {
+		vars = append(vars, var_str)
+	}
+	sort.Strings(vars)
+	for _, var_str := range vars {
+		v := jsonVariable{Id: var_str, Productions: [][]jsonSymbol{}}
+		for _, product := range cfg.Variables[var_str].Productions {
+			p := []jsonSymbol{}
+			for _, symbol := range product {
+				switch sb := symbol.(type) {
+				case *Variable:
+					p = append(p, jsonSymbol{"variable", sb.Id})
+				case *Terminal:
+					p = append(p, jsonSymbol{"terminal", sb.Value})
+				}
+			}
+			v.Productions = append(v.Productions, p)
+		}
+		j.Variables = append(j.Variables, v)
+	}
+	return json.Marshal(j)
+}
+
+func (cfg *CFG) UnmarshalJSON(data []byte) error {
+	var j jsonCFG
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	newcfg := NewCFG()
+	newcfg.Start = j.Start
+	get_var := func(var_str string) *Variable {
+		v, ok := newcfg.Variables[var_str]
+		if !ok {
+			v = NewVariable(var_str)
+			newcfg.Variables[var_str] = v
+		}
+		return v
+	}
+	for _, jv := range j.Variables {
+		v := get_var(jv.Id)
+		for _, jp := range jv.Productions {
+			var product []Symbol
+			for _, js := range jp {
+				switch js.Type {
+				case "variable":
+					product = append(product, get_var(js.Value))
+				case "terminal":
+					product = append(product, NewTerminal(js.Value))
+				default:
+					return fmt.Errorf("cfg json: unknown symbol type %q in %s", js.Type, jv.Id)
+				}
+			}
+			v.Productions = append(v.Productions, product)
+		}
+	}
+	*cfg = *newcfg
+	return nil
+}
@@ -0,0 +1,251 @@
+package automata
+
+import "container/list"
+
+// LazyDFA determinizes an nfa while matching, the way RE2 does: only the
+// sets of states met in the inputs become dfa states, and at most capacity
+// of them are kept, the least recently used going first. When the cache
+// thrashes on an input, the rest of that input is run by plain set
+// simulation instead. Epsilon closures and moves are computed as the sets
+// are met, so wrapping costs about as much memory as the nfa itself.
+//
+// As an Automata it is the nfa it wraps: GetStart, GetFinish and TransTable
+// are those of the nfa, and the functions of the package work on the nfa.
+// The nfa must not change while wrapped, SetStart is the only way to change
+// it. A LazyDFA is not safe for concurrent use.
+type LazyDFA struct {
+	nfa      NFAAutomata
+	capacity int
+	n        int             // numbered nfa states
+	symbols  map[string]int  // symbol -> number
+	trans    []map[int][]int // trans[state][symbol], not eclosed
+	eps      [][]int         // epsilon moves
+	final    bitset
+	start    bitset
+	dead     *lazyState
+	cache    map[string]*lazyState // bitset key -> state
+	lru      *list.List            // of *lazyState, most recent first
+	stats    LazyDFAStats
+}
+
+type lazyState struct {
+	set   bitset
+	key   string
+	final bool
+	next  []*lazyState  // by symbol, nil until computed
+	elem  *list.Element // nil once evicted
+}
+
+type LazyDFAStats struct {
+	Hits      int // steps along a cached transition
+	Misses    int // steps that had to compute their transition
+	Evictions int
+	Fallbacks int // inputs finished by set simulation
+}
+
+// NewLazyDFA keeps at most capacity dfa states, at least one
+func NewLazyDFA(nfa NFAAutomata, capacity int) *LazyDFA {
+	if capacity < 1 {
+		capacity = 1
+	}
+	l := &LazyDFA{nfa: nfa, capacity: capacity}
+	l.reset()
+	return l
+}
+
+// unwrap returns the nfa of a LazyDFA, and any other automata as it is
+func unwrap(at Automata) Automata {
+	if lazy, ok := at.(*LazyDFA); ok {
+		return lazy.nfa
+	}
+	return at
+}
+
+// reset numbers the states and symbols of the nfa and drops the cache
+func (l *LazyDFA) reset() {
+	_, is_enfa := l.nfa.(*eNFA)
+	number := make(map[string]int)
+	get_number := func(state string) int {
+		i, ok := number[state]
+		if !ok {
+			i = len(number)
+			number[state] = i
+			l.trans = append(l.trans, nil)
+			l.eps = append(l.eps, nil)
+		}
+		return i
+	}
+	l.symbols = make(map[string]int)
+	l.trans, l.eps = nil, nil
+	get_number(l.nfa.GetStart())
+	for state, state_obj := range l.nfa.GetStates() {
+		i := get_number(state)
+		for sb, dsts := range state_obj.Trans {
+			for dst, _ := range dsts {
+				j := get_number(dst)
+				if is_enfa && sb == epsilon {
+					l.eps[i] = append(l.eps[i], j)
+					continue
+				}
+				k, ok := l.symbols[sb]
+				if !ok {
+					k = len(l.symbols)
+					l.symbols[sb] = k
+				}
+				if l.trans[i] == nil {
+					l.trans[i] = make(map[int][]int)
+				}
+				l.trans[i][k] = append(l.trans[i][k], j)
+			}
+		}
+	}
+	for f, _ := range l.nfa.GetFinish() {
+		get_number(f)
+	}
+	l.n = len(number)
+	l.final = newBitset(l.n)
+	for f, _ := range l.nfa.GetFinish() {
+		l.final.insert(number[f])
+	}
+	l.start = newBitset(l.n)
+	l.start.insert(number[l.nfa.GetStart()])
+	l.eclose(l.start)
+	l.dead = &lazyState{set: newBitset(l.n)}
+	l.cache = make(map[string]*lazyState)
+	l.lru = list.New()
+}
+
+// eclose adds to set the states it reaches by epsilon moves
+func (l *LazyDFA) eclose(set bitset) {
+	var stack []int
+	set.each(func(s int) {
+		stack = append(stack, s)
+	})
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, dst := range l.eps[s] {
+			if !set.has(dst) {
+				set.insert(dst)
+				stack = append(stack, dst)
+			}
+		}
+	}
+}
+
+// move returns the eclosed set reached from set by symbol k
+func (l *LazyDFA) move(set bitset, k int) bitset {
+	next := newBitset(l.n)
+	set.each(func(s int) {
+		for _, dst := range l.trans[s][k] {
+			next.insert(dst)
+		}
+	})
+	l.eclose(next)
+	return next
+}
+
+func (l *LazyDFA) GetStart() string {
+	return l.nfa.GetStart()
+}
+
+// SetStart sets the start state of the wrapped nfa and drops the cache
+func (l *LazyDFA) SetStart(s string) {
+	l.nfa.SetStart(s)
+	l.reset()
+}
+
+func (l *LazyDFA) GetFinish() Set {
+	return l.nfa.GetFinish()
+}
+
+func (l *LazyDFA) TransTable() [][]string {
+	return l.nfa.TransTable()
+}
+
+// Len returns the number of cached states
+func (l *LazyDFA) Len() int {
+	return l.lru.Len()
+}
+
+func (l *LazyDFA) Stats() LazyDFAStats {
+	return l.stats
+}
+
+// intern returns the cached state of set, making room for it if new
+func (l *LazyDFA) intern(set bitset) *lazyState {
+	if set.empty() {
+		return l.dead
+	}
+	key := set.key()
+	if s, ok := l.cache[key]; ok {
+		l.lru.MoveToFront(s.elem)
+		return s
+	}
+	for l.lru.Len() >= l.capacity {
+		old := l.lru.Remove(l.lru.Back()).(*lazyState)
+		delete(l.cache, old.key)
+		old.elem = nil
+		old.next = nil // let go of what it points to
+		l.stats.Evictions++
+	}
+	s := &lazyState{set: set, key: key, final: set.intersects(l.final)}
+	s.next = make([]*lazyState, len(l.symbols))
+	s.elem = l.lru.PushFront(s)
+	l.cache[key] = s
+	return s
+}
+
+// step follows symbol k from the cached state s, computing the move when it
+// is not known or leads to an evicted state
+func (l *LazyDFA) step(s *lazyState, k int) *lazyState {
+	if next := s.next[k]; next == l.dead || (next != nil && next.elem != nil) {
+		l.stats.Hits++
+		if next != l.dead {
+			l.lru.MoveToFront(next.elem)
+		}
+		return next
+	}
+	l.stats.Misses++
+	next := l.intern(l.move(s.set, k))
+	if s.elem != nil { // s itself may go when the capacity is 1
+		s.next[k] = next
+	}
+	return next
+}
+
+// Match tells whether the nfa accepts symbols. An input thrashes when it has
+// evicted more states than the cache holds and at least every other step
+// missed the cache.
+func (l *LazyDFA) Match(symbols []string) bool {
+	cur := l.intern(l.start)
+	evictions := l.stats.Evictions
+	misses := l.stats.Misses
+	for i, sb := range symbols {
+		k, ok := l.symbols[sb]
+		if !ok || cur == l.dead {
+			return false
+		}
+		cur = l.step(cur, k)
+		if l.stats.Evictions-evictions > l.capacity && 2*(l.stats.Misses-misses) >= i+1 {
+			l.stats.Fallbacks++
+			return l.simulate(cur.set, symbols[i+1:])
+		}
+	}
+	return cur.final
+}
+
+// simulate runs the nfa on sets of states without caching
+func (l *LazyDFA) simulate(set bitset, symbols []string) bool {
+	for _, sb := range symbols {
+		k, ok := l.symbols[sb]
+		if !ok {
+			return false
+		}
+		set = l.move(set, k)
+		if set.empty() {
+			return false
+		}
+	}
+	return set.intersects(l.final)
+}
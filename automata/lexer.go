@@ -0,0 +1,141 @@
+package automata
+
+import "context"
+import "fmt"
+import "strconv"
+import "unicode/utf8"
+
+// Attr keys of the final lexer states: the token, and the index of its rule
+// which decides between rules matching the same text
+const (
+	TokenAttr    = "token"
+	PriorityAttr = "priority"
+)
+
+// LexRule is one token of a Lexer, given by a regex as in ParseRegex or,
+// when Automata is set, by an eNFA reading one character per symbol
+type LexRule struct {
+	Name     string
+	Pattern  string
+	Automata *eNFA
+}
+
+// Lexer splits text into tokens by maximal munch: the longest match wins,
+// and among rules matching the same text the first one. Every character of
+// the text is one symbol.
+type Lexer struct {
+	dfa *DFA
+}
+
+type Position struct {
+	Offset int // in bytes
+	Line   int // 1-based
+	Column int // 1-based, in characters
+}
+
+type Token struct {
+	Name string
+	Text string
+	Pos  Position
+}
+
+// LexError is where no rule matches, or only the empty text
+type LexError struct {
+	Pos  Position
+	Char rune
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("line %d, column %d: no token at %q", e.Pos.Line, e.Pos.Column, e.Char)
+}
+
+// firstRule is the AttrMerge of the lexer, keeping the Attr of the lowest
+// PriorityAttr
+func firstRule(attrs []map[string]string) map[string]string {
+	best, best_priority := attrs[0], -1
+	for _, attr := range attrs {
+		priority, err := strconv.Atoi(attr[PriorityAttr])
+		if err == nil && (best_priority < 0 || priority < best_priority) {
+			best, best_priority = attr, priority
+		}
+	}
+	return best
+}
+
+// NewLexer unions the rules into one eNFA and determinizes it, tagging
+// every final dfa state with the token of the first rule it accepts
+func NewLexer(rules []LexRule) (*Lexer, error) {
+	union := NeweNFA()
+	union.Start = "start" // the others begin with a rule number
+	union.AddState(union.Start)
+	for i, rule := range rules {
+		enfa := rule.Automata
+		if enfa == nil {
+			var err error
+			if enfa, err = ParseRegex(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+			}
+		}
+		prefix := strconv.Itoa(i) + "."
+		union.AddState(prefix + enfa.Start)
+		union.AddTrans(union.Start, epsilon, prefix+enfa.Start)
+		for _, record := range enfa.TransTable() {
+			union.AddTrans(prefix+record[0], record[1], prefix+record[2])
+			if record[1] != epsilon {
+				union.Symbols[record[1]] = nil
+			}
+		}
+		for f, _ := range enfa.Finish {
+			union.Finish.Insert(prefix + f)
+			union.AddState(prefix + f)
+			union.States[prefix+f].Attr[TokenAttr] = rule.Name
+			union.States[prefix+f].Attr[PriorityAttr] = strconv.Itoa(i)
+		}
+	}
+	dfa, _, err := ToDFAWithOptions(context.Background(), union, ToDFAOptions{MergeAttr: firstRule})
+	if err != nil {
+		return nil, err
+	}
+	return &Lexer{dfa}, nil
+}
+
+// DFA returns the dfa of the lexer, final states tagged with TokenAttr
+func (lx *Lexer) DFA() *DFA {
+	return lx.dfa
+}
+
+// Tokenize returns the tokens of text. On a lexical error it returns the
+// tokens before it and a *LexError.
+func (lx *Lexer) Tokenize(text string) ([]Token, error) {
+	var tokens []Token
+	pos := Position{0, 1, 1}
+	for pos.Offset < len(text) {
+		state := lx.dfa.Start
+		end, name := pos.Offset, ""
+		for i := pos.Offset; i < len(text); {
+			c, size := utf8.DecodeRuneInString(text[i:])
+			if state = lx.dfa.step(state, string(c)); state == "" {
+				break
+			}
+			i += size
+			if token, ok := lx.dfa.States[state].Attr[TokenAttr]; ok {
+				end, name = i, token
+			}
+		}
+		if end == pos.Offset {
+			c, _ := utf8.DecodeRuneInString(text[pos.Offset:])
+			return tokens, &LexError{pos, c}
+		}
+		tokens = append(tokens, Token{name, text[pos.Offset:end], pos})
+		for _, c := range text[pos.Offset:end] {
+			if c == '\n' {
+				pos.Line++
+				pos.Column = 1
+			} else {
+				pos.Column++
+			}
+		}
+		pos.Offset = end
+	}
+	return tokens, nil
+}
@@ -0,0 +1,267 @@
+package automata
+
+import "sort"
+import "strconv"
+import "github.com/golang-collections/go-datastructures/queue"
+
+// symbols used by the dfas, including the declared ones, sorted
+func dfaAlphabet(dfas ...*DFA) []string {
+	s := NewSet()
+	for _, dfa := range dfas {
+		for sb, _ := range dfa.Symbols {
+			s.Insert(sb)
+		}
+		for _, state_obj := range dfa.States {
+			for sb, _ := range state_obj.Trans {
+				s.Insert(sb)
+			}
+		}
+	}
+	var alphabet []string
+	for sb, _ := range s {
+		alphabet = append(alphabet, sb)
+	}
+	sort.Strings(alphabet)
+	return alphabet
+}
+
+// Minimize returns the minimal dfa accepting the same language. Unreachable
+// states are removed, equivalent states are merged by Hopcroft's algorithm
+// and the dead state is dropped again, so the result is partial like the
+// input. States are renamed q0, q1, ... in BFS order from the start state,
+// taking symbols in sorted order, so equal languages give equal dfas.
+// States with different Attr are never merged and keep their Attr.
+func Minimize(dfa *DFA) *DFA {
+	alphabet := dfaAlphabet(dfa)
+
+	// number the reachable states, n is the dead state
+	index := make(map[string]int)
+	var names []string
+	q := queue.New(10)
+	index[dfa.Start] = 0
+	names = append(names, dfa.Start)
+	q.Put(dfa.Start)
+	for !q.Empty() {
+		_s, _ := q.Get(1)
+		state := _s[0].(string)
+		state_obj, ok := dfa.States[state]
+		if !ok { // state only appears as a destination
+			continue
+		}
+		for _, sb := range alphabet {
+			dst, ok := state_obj.Trans[sb]
+			if !ok {
+				continue
+			}
+			if _, seen := index[dst]; !seen {
+				index[dst] = len(names)
+				names = append(names, dst)
+				q.Put(dst)
+			}
+		}
+	}
+	n := len(names)
+	dead := n
+	delta := make([][]int, n+1) // delta[state][symbol index]
+	for i := 0; i <= n; i++ {
+		delta[i] = make([]int, len(alphabet))
+		for a, sb := range alphabet {
+			delta[i][a] = dead
+			if i == dead {
+				continue
+			}
+			state_obj, ok := dfa.States[names[i]]
+			if !ok {
+				continue
+			}
+			if dst, ok := state_obj.Trans[sb]; ok {
+				delta[i][a] = index[dst]
+			}
+		}
+	}
+
+	// states start in the same block when both final or not, and of equal Attr
+	class := make([]int, n+1)
+	class_of := make(map[string]int)
+	for i := 0; i <= n; i++ {
+		key := "-"
+		if i != dead {
+			if dfa.Finish.Has(names[i]) {
+				key = "+"
+			}
+			if state_obj, ok := dfa.States[names[i]]; ok {
+				key += attrKey(state_obj.Attr)
+			}
+		}
+		c, ok := class_of[key]
+		if !ok {
+			c = len(class_of)
+			class_of[key] = c
+		}
+		class[i] = c
+	}
+	block := hopcroft(delta, class)
+
+	// the dead block is the one all missing transitions go to
+	dead_block := block[dead]
+	newdfa := NewDFA()
+	for _, sb := range alphabet {
+		newdfa.Symbols[sb] = nil
+	}
+	block_name := make(map[int]string)
+	get_name := func(b int) string {
+		name, ok := block_name[b]
+		if !ok {
+			name = "q" + strconv.Itoa(len(block_name))
+			block_name[b] = name
+			newdfa.States[name] = NewDFAstate()
+			newdfa.States[name].Id = name
+			q.Put(b)
+		}
+		return name
+	}
+	rep := make(map[int]int) // a member of each block
+	for i := n; i >= 0; i-- {
+		rep[block[i]] = i
+	}
+
+	newdfa.Start = get_name(block[0])
+	for !q.Empty() {
+		_b, _ := q.Get(1)
+		b := _b[0].(int)
+		state_obj := newdfa.States[block_name[b]]
+		if rep[b] != dead {
+			if dfa.Finish.Has(names[rep[b]]) {
+				newdfa.Finish.Insert(state_obj.Id)
+			}
+			if old_obj, ok := dfa.States[names[rep[b]]]; ok {
+				for k, v := range old_obj.Attr {
+					state_obj.Attr[k] = v
+				}
+			}
+		}
+		for a, sb := range alphabet {
+			dst := block[delta[rep[b]][a]]
+			if dst == dead_block {
+				continue
+			}
+			state_obj.Trans[sb] = get_name(dst)
+		}
+	}
+	return newdfa
+}
+
+// hopcroft refines the partition of a complete dfa into the given classes,
+// like {final, non final}, until it is stable and returns the block of every
+// state
+func hopcroft(delta [][]int, class []int) []int {
+	n := len(delta)
+	if n == 0 {
+		return nil
+	}
+	k := len(delta[0])
+
+	inverse := make([][][]int, k) // inverse[symbol][dst] = srcs
+	for a := 0; a < k; a++ {
+		inverse[a] = make([][]int, n)
+	}
+	for s := 0; s < n; s++ {
+		for a := 0; a < k; a++ {
+			inverse[a][delta[s][a]] = append(inverse[a][delta[s][a]], s)
+		}
+	}
+
+	block := make([]int, n)
+	var blocks [][]int
+	block_of := make(map[int]int) // class -> block
+	for s := 0; s < n; s++ {
+		b, ok := block_of[class[s]]
+		if !ok {
+			b = len(blocks)
+			block_of[class[s]] = b
+			blocks = append(blocks, nil)
+		}
+		block[s] = b
+		blocks[b] = append(blocks[b], s)
+	}
+
+	type splitter struct{ block, symbol int }
+	var work []splitter
+	inwork := make(map[splitter]bool)
+	push := func(sp splitter) {
+		if !inwork[sp] {
+			inwork[sp] = true
+			work = append(work, sp)
+		}
+	}
+	// every block but the largest splits
+	largest := 0
+	for b, members := range blocks {
+		if len(members) > len(blocks[largest]) {
+			largest = b
+		}
+	}
+	for b, _ := range blocks {
+		if b == largest {
+			continue
+		}
+		for a := 0; a < k; a++ {
+			push(splitter{b, a})
+		}
+	}
+
+	marked := make([]bool, n)
+	for len(work) > 0 {
+		sp := work[len(work)-1]
+		work = work[:len(work)-1]
+		delete(inwork, sp)
+
+		var srcs []int    // states going into the splitter
+		var touched []int // blocks of those states
+		count := make(map[int]int)
+		for _, dst := range blocks[sp.block] {
+			for _, src := range inverse[sp.symbol][dst] {
+				if marked[src] {
+					continue
+				}
+				marked[src] = true
+				srcs = append(srcs, src)
+				if count[block[src]] == 0 {
+					touched = append(touched, block[src])
+				}
+				count[block[src]]++
+			}
+		}
+		for _, b := range touched {
+			if count[b] == len(blocks[b]) {
+				continue
+			}
+			var in, out []int // split b into marked and unmarked
+			for _, s := range blocks[b] {
+				if marked[s] {
+					in = append(in, s)
+				} else {
+					out = append(out, s)
+				}
+			}
+			if len(out) < len(in) {
+				in, out = out, in
+			}
+			// b keeps the larger half. whether or not b is waiting, adding
+			// the smaller half for every symbol is enough
+			blocks[b] = out
+			newb := len(blocks)
+			blocks = append(blocks, in)
+			for _, s := range in {
+				block[s] = newb
+			}
+			for a := 0; a < k; a++ {
+				push(splitter{newb, a})
+			}
+		}
+		for _, s := range srcs {
+			marked[s] = false
+		}
+	}
+	return block
+}
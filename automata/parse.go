@@ -0,0 +1,232 @@
+package automata
+
+import "bufio"
+import "errors"
+import "fmt"
+import "io"
+import "strings"
+import "unicode/utf8"
+
+// The Parse functions read the same formats as the Deserialize ones but
+// return a *ParseError instead of panicking on bad input. Trailing spaces and
+// trailing blank lines are accepted, as found in the files of resources/.
+var (
+	ErrTooFewLines       = errors.New("expect a start line, a finish line and transitions")
+	ErrBadStart          = errors.New("expect exactly one start state")
+	ErrFieldCount        = errors.New("expect \"from symbol to\"")
+	ErrEmptyField        = errors.New("empty field, states and symbols are separated by one space")
+	ErrNondeterministic  = errors.New("second transition for the same state and symbol in a DFA")
+	ErrUnknownStart      = errors.New("start state appears in no transition and is not a finish state")
+	ErrBadProduction     = errors.New("expect \"Variable -> symbols\"")
+	ErrUnterminatedQuote = errors.New("unterminated terminal quote")
+)
+
+type ParseError struct {
+	Line   int // 1-based
+	Column int // 1-based, 0 when the whole line or input is at fault
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+type field struct {
+	text   string
+	column int
+}
+
+// readLines returns the lines without trailing spaces and trailing blank lines
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), " \r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// splitFields splits a line starting at column on single spaces, reporting
+// empty fields
+func splitFields(line string, lineno int, column int) ([]field, error) {
+	var fields []field
+	for _, text := range strings.Split(line, " ") {
+		if text == "" {
+			return nil, &ParseError{lineno, column, ErrEmptyField}
+		}
+		fields = append(fields, field{text, column})
+		column += utf8.RuneCountInString(text) + 1
+	}
+	return fields, nil
+}
+
+func parseAutomata(r io.Reader, at Automata, insert func(from string, symbol string, to string) error) error {
+	lines, err := readLines(r)
+	if err != nil {
+		return err
+	}
+	if len(lines) <= 2 {
+		return &ParseError{len(lines) + 1, 0, ErrTooFewLines}
+	}
+	if lines[0] == "" || strings.Contains(lines[0], " ") {
+		return &ParseError{1, 0, ErrBadStart}
+	}
+	at.SetStart(lines[0])
+	if lines[1] != "" {
+		fields, err := splitFields(lines[1], 2, 1)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			at.GetFinish().Insert(f.text)
+		}
+	}
+
+	known := at.GetFinish().Has(at.GetStart())
+	for i, line := range lines[2:] {
+		lineno := i + 3
+		if line == "" {
+			return &ParseError{lineno, 0, ErrFieldCount}
+		}
+		fields, err := splitFields(line, lineno, 1)
+		if err != nil {
+			return err
+		}
+		if len(fields) != 3 {
+			column := 0
+			if len(fields) > 3 {
+				column = fields[3].column
+			}
+			return &ParseError{lineno, column, ErrFieldCount}
+		}
+		if err := insert(fields[0].text, fields[1].text, fields[2].text); err != nil {
+			return &ParseError{lineno, fields[1].column, err}
+		}
+		if fields[0].text == at.GetStart() || fields[2].text == at.GetStart() {
+			known = true
+		}
+	}
+	if !known {
+		return &ParseError{1, 1, ErrUnknownStart}
+	}
+	return nil
+}
+
+func ParseDFA(r io.Reader) (*DFA, error) {
+	dfa := NewDFA()
+	add_state := func(state string) {
+		if _, ok := dfa.States[state]; !ok {
+			dfa.States[state] = NewDFAstate()
+			dfa.States[state].Id = state
+		}
+	}
+	insert := func(from string, symbol string, to string) error {
+		add_state(from)
+		add_state(to)
+		dst, ok := dfa.States[from].Trans[symbol]
+		if ok && dst != to {
+			return ErrNondeterministic
+		}
+		dfa.States[from].Trans[symbol] = to
+		dfa.Symbols[symbol] = nil
+		return nil
+	}
+	if err := parseAutomata(r, dfa, insert); err != nil {
+		return nil, err
+	}
+	return dfa, nil
+}
+
+func ParseNFA(r io.Reader) (*NFA, error) {
+	nfa := NewNFA()
+	insert := func(from string, symbol string, to string) error {
+		nfa.addTrans(from, symbol, to)
+		nfa.Symbols[symbol] = nil
+		return nil
+	}
+	if err := parseAutomata(r, nfa, insert); err != nil {
+		return nil, err
+	}
+	return nfa, nil
+}
+
+func ParseENFA(r io.Reader) (*eNFA, error) {
+	enfa := NeweNFA()
+	insert := func(from string, symbol string, to string) error {
+		enfa.AddTrans(from, symbol, to)
+		if symbol != epsilon {
+			enfa.Symbols[symbol] = nil
+		}
+		return nil
+	}
+	if err := parseAutomata(r, enfa, insert); err != nil {
+		return nil, err
+	}
+	return enfa, nil
+}
+
+// ParseCFG reads productions like CFGDeserialize, one "A -> B "b"" per line,
+// the first line giving the start variable. Blank lines are skipped.
+func ParseCFG(r io.Reader) (*CFG, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	cfg := NewCFG()
+	get_var := func(var_str string) *Variable {
+		v, ok := cfg.Variables[var_str]
+		if !ok {
+			v = NewVariable(var_str)
+			cfg.Variables[var_str] = v
+		}
+		return v
+	}
+	for i, line := range lines {
+		lineno := i + 1
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			continue
+		}
+		fields, err := splitFields(trimmed, lineno, len(line)-len(trimmed)+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 3 || fields[1].text != "->" {
+			return nil, &ParseError{lineno, 0, ErrBadProduction}
+		}
+		if strings.Contains(fields[0].text, "\"") {
+			return nil, &ParseError{lineno, fields[0].column, ErrBadProduction}
+		}
+		v := get_var(fields[0].text)
+		if cfg.Start == "" {
+			cfg.Start = v.Id
+		}
+		var product []Symbol
+		for _, f := range fields[2:] {
+			quoted := strings.HasPrefix(f.text, "\"")
+			if quoted != strings.HasSuffix(f.text, "\"") || f.text == "\"" {
+				return nil, &ParseError{lineno, f.column, ErrUnterminatedQuote}
+			}
+			if quoted {
+				product = append(product, NewTerminal(f.text[1:len(f.text)-1]))
+			} else {
+				product = append(product, get_var(f.text))
+			}
+		}
+		v.Productions = append(v.Productions, product)
+	}
+	return cfg, nil
+}
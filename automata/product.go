@@ -0,0 +1,106 @@
+package automata
+
+import "github.com/golang-collections/go-datastructures/queue"
+
+// Product builds the reachable part of the product of two dfas over the union
+// of their alphabets. A missing transition goes to an implicit sink on that
+// side, so both machines are complete. A product state is final when
+// isfinal(final in dfa1, final in dfa2) holds and is named "(s1|s2)", the
+// sink showing up as "-". Pairs of two sinks are left out, keeping the
+// result partial like the inputs. The Attr of the two states are merged by
+// merge, MergeAttrUnion if nil.
+func Product(dfa1 *DFA, dfa2 *DFA, isfinal func(bool, bool) bool, merge AttrMerge) *DFA {
+	alphabet := dfaAlphabet(dfa1, dfa2)
+
+	type pair struct {
+		s1, s2 string
+	}
+	sink1 := sinkName(dfa1)
+	sink2 := sinkName(dfa2)
+	name := func(p pair) string {
+		s1, s2 := p.s1, p.s2
+		if s1 == "" {
+			s1 = sink1
+		}
+		if s2 == "" {
+			s2 = sink2
+		}
+		return "(" + s1 + "|" + s2 + ")"
+	}
+
+	newdfa := NewDFA()
+	for _, sb := range alphabet {
+		newdfa.Symbols[sb] = nil
+	}
+	q := queue.New(10)
+	visit := func(p pair) string {
+		id := name(p)
+		if _, ok := newdfa.States[id]; !ok {
+			newdfa.States[id] = NewDFAstate()
+			newdfa.States[id].Id = id
+			f1 := p.s1 != "" && dfa1.Finish.Has(p.s1)
+			f2 := p.s2 != "" && dfa2.Finish.Has(p.s2)
+			if isfinal(f1, f2) {
+				newdfa.Finish.Insert(id)
+			}
+			var attrs []map[string]string
+			if state_obj, ok := dfa1.States[p.s1]; ok {
+				attrs = append(attrs, state_obj.Attr)
+			}
+			if state_obj, ok := dfa2.States[p.s2]; ok {
+				attrs = append(attrs, state_obj.Attr)
+			}
+			mergeAttr(newdfa.States[id].Attr, merge, attrs...)
+			q.Put(p)
+		}
+		return id
+	}
+
+	newdfa.Start = visit(pair{dfa1.Start, dfa2.Start})
+	for !q.Empty() {
+		_p, _ := q.Get(1)
+		p := _p[0].(pair)
+		state_obj := newdfa.States[name(p)]
+		for _, sb := range alphabet {
+			dst := pair{dfa1.step(p.s1, sb), dfa2.step(p.s2, sb)}
+			if dst.s1 == "" && dst.s2 == "" {
+				continue
+			}
+			state_obj.Trans[sb] = visit(dst)
+		}
+	}
+	return newdfa
+}
+
+// sinkName returns a name for the missing dead state not used by the dfa
+func sinkName(dfa *DFA) string {
+	used := NewSet()
+	used.Insert(dfa.Start)
+	for state, state_obj := range dfa.States {
+		used.Insert(state)
+		for _, dst := range state_obj.Trans {
+			used.Insert(dst)
+		}
+	}
+	name := "-"
+	for used.Has(name) {
+		name += "-"
+	}
+	return name
+}
+
+func Intersect(dfa1 *DFA, dfa2 *DFA) *DFA {
+	return Product(dfa1, dfa2, func(f1, f2 bool) bool { return f1 && f2 }, nil)
+}
+
+func Union(dfa1 *DFA, dfa2 *DFA) *DFA {
+	return Product(dfa1, dfa2, func(f1, f2 bool) bool { return f1 || f2 }, nil)
+}
+
+func Difference(dfa1 *DFA, dfa2 *DFA) *DFA {
+	return Product(dfa1, dfa2, func(f1, f2 bool) bool { return f1 && !f2 }, nil)
+}
+
+func SymmetricDifference(dfa1 *DFA, dfa2 *DFA) *DFA {
+	return Product(dfa1, dfa2, func(f1, f2 bool) bool { return f1 != f2 }, nil)
+}
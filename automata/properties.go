@@ -0,0 +1,271 @@
+package automata
+
+import "math/big"
+import "sort"
+
+type transEdge struct {
+	symbol string
+	to     string
+}
+
+// transGraph turns the TransTable into sorted adjacency lists. Symbol ""
+// marks an epsilon move of an eNFA.
+func transGraph(at Automata) map[string][]transEdge {
+	at = unwrap(at)
+	_, is_enfa := at.(*eNFA)
+	graph := make(map[string][]transEdge)
+	for _, record := range at.TransTable() {
+		sb := record[1]
+		if is_enfa && sb == epsilon {
+			sb = ""
+		}
+		graph[record[0]] = append(graph[record[0]], transEdge{sb, record[2]})
+	}
+	for _, edges := range graph {
+		sort.Slice(edges, func(i, j int) bool {
+			if edges[i].symbol != edges[j].symbol {
+				return edges[i].symbol < edges[j].symbol
+			}
+			return edges[i].to < edges[j].to
+		})
+	}
+	return graph
+}
+
+// useful returns the states both reachable from the start and able to reach
+// a finish state
+func useful(at Automata, graph map[string][]transEdge) Set {
+	reverse := make(map[string][]string)
+	for from, edges := range graph {
+		for _, e := range edges {
+			reverse[e.to] = append(reverse[e.to], from)
+		}
+	}
+	reach := func(from []string, next func(string) []string) Set {
+		s := NewSet()
+		stack := from
+		for _, state := range from {
+			s.Insert(state)
+		}
+		for len(stack) > 0 {
+			state := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, dst := range next(state) {
+				if !s.Has(dst) {
+					s.Insert(dst)
+					stack = append(stack, dst)
+				}
+			}
+		}
+		return s
+	}
+
+	forward := reach([]string{at.GetStart()}, func(state string) []string {
+		var dsts []string
+		for _, e := range graph[state] {
+			dsts = append(dsts, e.to)
+		}
+		return dsts
+	})
+	var finish []string
+	for f, _ := range at.GetFinish() {
+		finish = append(finish, f)
+	}
+	backward := reach(finish, func(state string) []string {
+		return reverse[state]
+	})
+	s := NewSet()
+	for state, _ := range forward {
+		if backward.Has(state) {
+			s.Insert(state)
+		}
+	}
+	return s
+}
+
+// IsEmpty tells whether the automata accepts nothing. Otherwise a shortest
+// accepted word is returned as witness.
+func IsEmpty(at Automata) (bool, []string) {
+	graph := transGraph(at)
+	type parent struct {
+		from   string
+		symbol string
+	}
+	// 0-1 BFS, epsilon moves cost nothing
+	dist := make(map[string]int)
+	parents := make(map[string]parent)
+	start := at.GetStart()
+	dist[start] = 0
+	deque := []string{start}
+	done := NewSet()
+	for len(deque) > 0 {
+		state := deque[0]
+		deque = deque[1:]
+		if done.Has(state) {
+			continue
+		}
+		done.Insert(state)
+		if at.GetFinish().Has(state) {
+			var word []string
+			for state != start {
+				p := parents[state]
+				if p.symbol != "" {
+					word = append([]string{p.symbol}, word...)
+				}
+				state = p.from
+			}
+			return false, word
+		}
+		for _, e := range graph[state] {
+			cost := 1
+			if e.symbol == "" {
+				cost = 0
+			}
+			d, seen := dist[e.to]
+			if seen && d <= dist[state]+cost {
+				continue
+			}
+			dist[e.to] = dist[state] + cost
+			parents[e.to] = parent{state, e.symbol}
+			if cost == 0 {
+				deque = append([]string{e.to}, deque...)
+			} else {
+				deque = append(deque, e.to)
+			}
+		}
+	}
+	return true, nil
+}
+
+// IsUniversal tells whether every word over the alphabet is accepted.
+// Otherwise a shortest rejected word is returned.
+func IsUniversal(at Automata, alphabet []string) (bool, []string) {
+	dfa := determinize(at)
+	symbols := make([]string, len(alphabet))
+	copy(symbols, alphabet)
+	sort.Strings(symbols)
+
+	type node struct {
+		state string
+		word  []string
+	}
+	visited := NewSet()
+	visited.Insert(dfa.Start)
+	q := []node{{dfa.Start, []string{}}}
+	for len(q) > 0 {
+		n := q[0]
+		q = q[1:]
+		if n.state == "" || !dfa.Finish.Has(n.state) {
+			return false, n.word
+		}
+		for _, sb := range symbols {
+			dst := dfa.step(n.state, sb)
+			if dst != "" && visited.Has(dst) {
+				continue
+			}
+			visited.Insert(dst)
+			word := make([]string, len(n.word)+1)
+			copy(word, n.word)
+			word[len(n.word)] = sb
+			q = append(q, node{dst, word})
+		}
+	}
+	return true, nil
+}
+
+// IsFinite tells whether the language is finite, that is whether no cycle
+// reading a symbol lies on a path from the start to a finish state
+func IsFinite(at Automata) bool {
+	graph := transGraph(at)
+	keep := useful(at, graph)
+
+	// Tarjan's strongly connected components over the useful states
+	index := make(map[string]int)
+	low := make(map[string]int)
+	on_stack := NewSet()
+	comp := make(map[string]int)
+	var stack []string
+	count := 0
+	var strongconnect func(string)
+	strongconnect = func(v string) {
+		index[v] = count
+		low[v] = count
+		count++
+		stack = append(stack, v)
+		on_stack.Insert(v)
+		for _, e := range graph[v] {
+			if !keep.Has(e.to) {
+				continue
+			}
+			if _, ok := index[e.to]; !ok {
+				strongconnect(e.to)
+				if low[e.to] < low[v] {
+					low[v] = low[e.to]
+				}
+			} else if on_stack.Has(e.to) && index[e.to] < low[v] {
+				low[v] = index[e.to]
+			}
+		}
+		if low[v] == index[v] {
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				on_stack.Delete(w)
+				comp[w] = index[v]
+				if w == v {
+					break
+				}
+			}
+		}
+	}
+	for v, _ := range keep {
+		if _, ok := index[v]; !ok {
+			strongconnect(v)
+		}
+	}
+
+	for v, _ := range keep {
+		for _, e := range graph[v] {
+			if e.symbol != "" && keep.Has(e.to) && comp[e.to] == comp[v] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// LanguageSize returns the number of accepted words. The bool is false, and
+// the count nil, when the language is infinite.
+func LanguageSize(at Automata) (*big.Int, bool) {
+	if !IsFinite(at) {
+		return nil, false
+	}
+	dfa := determinize(at)
+	keep := useful(dfa, transGraph(dfa))
+
+	// a word is a path in the dfa, count paths of the useful dag
+	memo := make(map[string]*big.Int)
+	var count func(string) *big.Int
+	count = func(state string) *big.Int {
+		if n, ok := memo[state]; ok {
+			return n
+		}
+		n := big.NewInt(0)
+		if dfa.Finish.Has(state) {
+			n.SetInt64(1)
+		}
+		if state_obj, ok := dfa.States[state]; ok {
+			for _, dst := range state_obj.Trans {
+				if keep.Has(dst) {
+					n.Add(n, count(dst))
+				}
+			}
+		}
+		memo[state] = n
+		return n
+	}
+	if !keep.Has(dfa.Start) {
+		return big.NewInt(0), true
+	}
+	return count(dfa.Start), true
+}
@@ -0,0 +1,237 @@
+package automata
+
+import "fmt"
+import "strconv"
+
+// ParseRegex compiles a regular expression into an eNFA by Thompson's
+// construction. Every character is one symbol, as in Accept(at, Makelist(s)).
+// Supported are concatenation, |, *, +, ?, grouping with (), character
+// classes like [0-9a-f] and escapes with \ (\n, \t and \r included). There
+// is no wildcard: the alphabet is open, so . is an ordinary symbol.
+func ParseRegex(regex string) (*eNFA, error) {
+	p := regexParser{input: []rune(regex), enfa: NeweNFA()}
+	frag, err := p.parseAlt()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.input) { // only an unmatched ) stops the top level
+		return nil, p.errorf("unmatched )")
+	}
+	p.enfa.Start = frag.start
+	p.enfa.Finish.Insert(frag.end)
+	return p.enfa, nil
+}
+
+type regexParser struct {
+	input []rune
+	pos   int
+	count int
+	enfa  *eNFA
+}
+
+// a piece of the eNFA with one entry and one exit state
+type fragment struct {
+	start, end string
+}
+
+func (p *regexParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("regex %q at %d: %s", string(p.input), p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *regexParser) newState() string {
+	id := "q" + strconv.Itoa(p.count)
+	p.count++
+	p.enfa.AddState(id)
+	return id
+}
+
+func (p *regexParser) addTrans(from string, symbol string, to string) {
+	p.enfa.AddTrans(from, symbol, to)
+	if symbol != epsilon {
+		p.enfa.Symbols[symbol] = nil
+	}
+}
+
+func (p *regexParser) peek() (rune, bool) {
+	if p.pos >= len(p.input) {
+		return 0, false
+	}
+	return p.input[p.pos], true
+}
+
+func (p *regexParser) parseAlt() (fragment, error) {
+	frag, err := p.parseConcat()
+	if err != nil {
+		return frag, err
+	}
+	for {
+		c, ok := p.peek()
+		if !ok || c != '|' {
+			return frag, nil
+		}
+		p.pos++
+		right, err := p.parseConcat()
+		if err != nil {
+			return right, err
+		}
+		alt := fragment{p.newState(), p.newState()}
+		p.addTrans(alt.start, epsilon, frag.start)
+		p.addTrans(alt.start, epsilon, right.start)
+		p.addTrans(frag.end, epsilon, alt.end)
+		p.addTrans(right.end, epsilon, alt.end)
+		frag = alt
+	}
+}
+
+func (p *regexParser) parseConcat() (fragment, error) {
+	var frag fragment
+	empty := true
+	for {
+		c, ok := p.peek()
+		if !ok || c == '|' || c == ')' {
+			break
+		}
+		next, err := p.parseRepeat()
+		if err != nil {
+			return next, err
+		}
+		if empty {
+			frag = next
+			empty = false
+		} else {
+			p.addTrans(frag.end, epsilon, next.start)
+			frag.end = next.end
+		}
+	}
+	if empty { // matches the empty word
+		s := p.newState()
+		frag = fragment{s, s}
+	}
+	return frag, nil
+}
+
+func (p *regexParser) parseRepeat() (fragment, error) {
+	frag, err := p.parseAtom()
+	if err != nil {
+		return frag, err
+	}
+	for {
+		c, ok := p.peek()
+		if !ok || (c != '*' && c != '+' && c != '?') {
+			return frag, nil
+		}
+		p.pos++
+		rep := fragment{p.newState(), p.newState()}
+		p.addTrans(rep.start, epsilon, frag.start)
+		p.addTrans(frag.end, epsilon, rep.end)
+		if c != '+' { // can be skipped
+			p.addTrans(rep.start, epsilon, rep.end)
+		}
+		if c != '?' { // can be repeated
+			p.addTrans(frag.end, epsilon, frag.start)
+		}
+		frag = rep
+	}
+}
+
+func (p *regexParser) parseAtom() (fragment, error) {
+	c, _ := p.peek()
+	switch c {
+	case '(':
+		p.pos++
+		frag, err := p.parseAlt()
+		if err != nil {
+			return frag, err
+		}
+		if c, ok := p.peek(); !ok || c != ')' {
+			return frag, p.errorf("missing )")
+		}
+		p.pos++
+		return frag, nil
+	case '[':
+		p.pos++
+		symbols, err := p.parseClass()
+		if err != nil {
+			return fragment{}, err
+		}
+		return p.symbolsFragment(symbols), nil
+	case '*', '+', '?':
+		return fragment{}, p.errorf("nothing to repeat before %c", c)
+	}
+	c, err := p.parseChar()
+	if err != nil {
+		return fragment{}, err
+	}
+	return p.symbolsFragment([]rune{c}), nil
+}
+
+// parseChar reads one possibly escaped character
+func (p *regexParser) parseChar() (rune, error) {
+	c := p.input[p.pos]
+	p.pos++
+	if c != '\\' {
+		return c, nil
+	}
+	c, ok := p.peek()
+	if !ok {
+		return 0, p.errorf("trailing \\")
+	}
+	p.pos++
+	switch c {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	}
+	return c, nil
+}
+
+func (p *regexParser) parseClass() ([]rune, error) {
+	var symbols []rune
+	if c, ok := p.peek(); ok && c == '^' {
+		return nil, p.errorf("negated class needs an alphabet, not supported")
+	}
+	for {
+		c, ok := p.peek()
+		if !ok {
+			return nil, p.errorf("missing ]")
+		}
+		if c == ']' {
+			p.pos++
+			break
+		}
+		lo, err := p.parseChar()
+		if err != nil {
+			return nil, err
+		}
+		hi := lo
+		c, ok = p.peek()
+		if ok && c == '-' && p.pos+1 < len(p.input) && p.input[p.pos+1] != ']' {
+			p.pos++
+			hi, err = p.parseChar()
+			if err != nil {
+				return nil, err
+			}
+			if hi < lo {
+				return nil, p.errorf("bad range %c-%c", lo, hi)
+			}
+		}
+		for r := lo; r <= hi; r++ {
+			symbols = append(symbols, r)
+		}
+	}
+	if len(symbols) == 0 {
+		return nil, p.errorf("empty class")
+	}
+	return symbols, nil
+}
+
+func (p *regexParser) symbolsFragment(symbols []rune) fragment {
+	frag := fragment{p.newState(), p.newState()}
+	for _, c := range symbols {
+		p.addTrans(frag.start, string(c), frag.end)
+	}
+	return frag
+}
@@ -0,0 +1,117 @@
+package automata
+
+import "strconv"
+import "github.com/golang-collections/go-datastructures/queue"
+
+// Reverse returns an eNFA accepting the reversed words. Every transition is
+// flipped, a new start state, named "^" or longer, has epsilon moves to the
+// old finish states, and the old start state is the only finish state. The
+// states keep their Attr and the alphabet is kept.
+func Reverse(at Automata) *eNFA {
+	at = unwrap(at)
+	_, is_enfa := at.(*eNFA)
+	rev := NeweNFA()
+	used := NewSet()
+	used.Insert(at.GetStart())
+	add_state := func(state string, attr map[string]string) {
+		used.Insert(state)
+		rev.AddState(state)
+		for k, v := range attr {
+			rev.States[state].Attr[k] = v
+		}
+	}
+	var nfa *NFA
+	switch a := at.(type) {
+	case *DFA:
+		for state, state_obj := range a.States {
+			add_state(state, state_obj.Attr)
+		}
+		for sb, _ := range a.Symbols {
+			rev.Symbols[sb] = nil
+		}
+	case *NFA:
+		nfa = a
+	case *eNFA:
+		nfa = &a.NFA
+	default:
+		panic("Unknown automata type")
+	}
+	if nfa != nil {
+		for state, state_obj := range nfa.States {
+			add_state(state, state_obj.Attr)
+		}
+		for sb, _ := range nfa.Symbols {
+			if !(is_enfa && sb == epsilon) {
+				rev.Symbols[sb] = nil
+			}
+		}
+	}
+	for _, record := range at.TransTable() {
+		used.Insert(record[0])
+		used.Insert(record[2])
+		rev.AddTrans(record[2], record[1], record[0])
+		if !(is_enfa && record[1] == epsilon) {
+			rev.Symbols[record[1]] = nil
+		}
+	}
+	for f, _ := range at.GetFinish() {
+		used.Insert(f)
+	}
+	start := "^"
+	for used.Has(start) {
+		start += "^"
+	}
+	rev.AddState(start)
+	for f, _ := range at.GetFinish() {
+		rev.AddTrans(start, epsilon, f)
+	}
+	rev.Start = start
+	rev.Finish.Insert(at.GetStart())
+	return rev
+}
+
+// BrzozowskiMinimize is Minimize by Brzozowski's algorithm: reverse,
+// determinize, reverse and determinize again. It can take exponential time
+// where Minimize does not, but shares no code with it, which makes it a
+// check of the other. States are named the same way, so for automata without
+// Attr both give equal dfas. Attr are dropped, as the merges would mix them.
+func BrzozowskiMinimize(at Automata) *DFA {
+	return renameBFS(numberedDFA(Reverse(numberedDFA(Reverse(at)))))
+}
+
+// renameBFS names the states q0, q1, ... in BFS order from the start state,
+// taking symbols in sorted order
+func renameBFS(dfa *DFA) *DFA {
+	alphabet := dfaAlphabet(dfa)
+	newdfa := NewDFA()
+	for _, sb := range alphabet {
+		newdfa.Symbols[sb] = nil
+	}
+	names := make(map[string]string)
+	q := queue.New(10)
+	get_name := func(state string) string {
+		name, ok := names[state]
+		if !ok {
+			name = "q" + strconv.Itoa(len(names))
+			names[state] = name
+			newdfa.States[name] = NewDFAstate()
+			newdfa.States[name].Id = name
+			if dfa.Finish.Has(state) {
+				newdfa.Finish.Insert(name)
+			}
+			q.Put(state)
+		}
+		return name
+	}
+	newdfa.Start = get_name(dfa.Start)
+	for !q.Empty() {
+		_s, _ := q.Get(1)
+		state := _s[0].(string)
+		for _, sb := range alphabet {
+			if dst := dfa.step(state, sb); dst != "" {
+				newdfa.States[names[state]].Trans[sb] = get_name(dst)
+			}
+		}
+	}
+	return newdfa
+}
@@ -0,0 +1,82 @@
+package automata
+
+import "errors"
+
+var ErrStuck = errors.New("no transition left for the input")
+
+// Runner feeds an automata one symbol at a time, for input that does not
+// arrive all at once. It keeps the set of current states, after epsilon
+// closure for an eNFA; a LazyDFA is run on the nfa it wraps. The automata
+// must not change while running.
+type Runner struct {
+	at     Automata
+	states Set
+	pos    int
+}
+
+// RunnerState is a saved position of a Runner
+type RunnerState struct {
+	states Set
+	pos    int
+}
+
+func NewRunner(at Automata) *Runner {
+	r := &Runner{at: at}
+	r.Reset()
+	return r
+}
+
+// Reset goes back to the start, before any symbol
+func (r *Runner) Reset() {
+	r.states = startStates(r.at)
+	r.pos = 0
+}
+
+// Step consumes one symbol. It returns ErrStuck, and stays dead, once no
+// state is left: no further input can be accepted.
+func (r *Runner) Step(symbol string) error {
+	if r.Dead() {
+		return ErrStuck
+	}
+	r.states = nextStates(r.at, r.states, symbol)
+	r.pos++
+	if r.Dead() {
+		return ErrStuck
+	}
+	return nil
+}
+
+// Accepting tells whether the symbols so far are accepted
+func (r *Runner) Accepting() bool {
+	for state, _ := range r.states {
+		if r.at.GetFinish().Has(state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) Dead() bool {
+	return len(r.states) == 0
+}
+
+// Pos returns the number of symbols consumed
+func (r *Runner) Pos() int {
+	return r.pos
+}
+
+// States returns a copy of the current states
+func (r *Runner) States() Set {
+	return r.states.Copy()
+}
+
+// Snapshot saves the current position for Restore. The sets are never
+// changed in place, so this is cheap.
+func (r *Runner) Snapshot() RunnerState {
+	return RunnerState{r.states, r.pos}
+}
+
+func (r *Runner) Restore(s RunnerState) {
+	r.states = s.states
+	r.pos = s.pos
+}
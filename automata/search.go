@@ -0,0 +1,128 @@
+package automata
+
+// Span is the match symbols[Start:End]
+type Span struct {
+	Start, End int
+}
+
+// unanchoredReverse returns an eNFA reading the input backwards, which is in
+// a finish state right where a match of at begins: the Reverse of at with
+// its start looping on every symbol, as if preceded by Σ*.
+func unanchoredReverse(at Automata) *eNFA {
+	rev := Reverse(at)
+	for sb, _ := range rev.Symbols {
+		rev.AddTrans(rev.Start, sb, rev.Start)
+	}
+	return rev
+}
+
+// matchStarts tells for every position of symbols, the end included,
+// whether a match begins there. It is one backward pass of the reverse,
+// determinized lazily as its dfa can be exponentially larger.
+func matchStarts(at Automata, symbols []string) []bool {
+	rev := NewLazyDFA(unanchoredReverse(at), 1024)
+	starts := make([]bool, len(symbols)+1)
+	cur := rev.intern(rev.start)
+	starts[len(symbols)] = cur.final
+	for i := len(symbols) - 1; i >= 0; i-- {
+		k, ok := rev.symbols[symbols[i]]
+		if ok {
+			cur = rev.step(cur, k)
+		}
+		if !ok || cur == rev.dead { // a symbol of no match, start over
+			cur = rev.intern(rev.start)
+		}
+		starts[i] = cur.final
+	}
+	return starts
+}
+
+// longestAt returns the end of the longest match beginning at start by set
+// simulation, false if there is none
+func longestAt(at Automata, symbols []string, start int) (int, bool) {
+	end, found := 0, false
+	states := startStates(at)
+	for i := start; ; i++ {
+		for state, _ := range states {
+			if at.GetFinish().Has(state) {
+				end, found = i, true
+				break
+			}
+		}
+		if i == len(symbols) {
+			return end, found
+		}
+		states = nextStates(at, states, symbols[i])
+		if len(states) == 0 {
+			return end, found
+		}
+	}
+}
+
+// FindLongestPrefix returns the length of the longest accepted prefix
+func FindLongestPrefix(at Automata, symbols []string) (int, bool) {
+	return longestAt(unwrap(at), symbols, 0)
+}
+
+// FindFirst returns the leftmost match, the longest one among those
+// beginning there
+func FindFirst(at Automata, symbols []string) (Span, bool) {
+	at = unwrap(at)
+	for i, ok := range matchStarts(at, symbols) {
+		if ok {
+			end, _ := longestAt(at, symbols, i)
+			return Span{i, end}, true
+		}
+	}
+	return Span{}, false
+}
+
+// FindAll returns the leftmost-longest matches that do not overlap, from
+// left to right. Like the regexp package, an empty match right after
+// another match is left out.
+func FindAll(at Automata, symbols []string) []Span {
+	at = unwrap(at)
+	var spans []Span
+	starts := matchStarts(at, symbols)
+	last := -1 // end of the previous match
+	for i := 0; i <= len(symbols); {
+		if !starts[i] {
+			i++
+			continue
+		}
+		end, _ := longestAt(at, symbols, i)
+		if end == i && i == last {
+			i++
+			continue
+		}
+		spans = append(spans, Span{i, end})
+		last = end
+		if end > i {
+			i = end
+		} else {
+			i++
+		}
+	}
+	return spans
+}
+
+// byteSymbols makes every byte a symbol, so spans index the bytes
+func byteSymbols(b []byte) []string {
+	symbols := make([]string, len(b))
+	for i, c := range b {
+		symbols[i] = string([]byte{c})
+	}
+	return symbols
+}
+
+func FindLongestPrefixBytes(at Automata, b []byte) (int, bool) {
+	return FindLongestPrefix(at, byteSymbols(b))
+}
+
+func FindFirstBytes(at Automata, b []byte) (Span, bool) {
+	return FindFirst(at, byteSymbols(b))
+}
+
+func FindAllBytes(at Automata, b []byte) []Span {
+	return FindAll(at, byteSymbols(b))
+}
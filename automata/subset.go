@@ -0,0 +1,352 @@
+package automata
+
+import "context"
+import "errors"
+import "math/bits"
+import "sort"
+import "strconv"
+import "strings"
+import "time"
+
+// bitset is a set of numbered nfa states
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) insert(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (b bitset) union(other bitset) {
+	for i, w := range other {
+		b[i] |= w
+	}
+}
+
+func (b bitset) intersect(other bitset) {
+	for i, w := range other {
+		b[i] &= w
+	}
+}
+
+func (b bitset) intersects(other bitset) bool {
+	for i, w := range other {
+		if b[i]&w != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (b bitset) empty() bool {
+	for _, w := range b {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// each calls f on the members in increasing order
+func (b bitset) each(f func(int)) {
+	for i, w := range b {
+		for w != 0 {
+			j := bits.TrailingZeros64(w)
+			f(i*64 + j)
+			w &= w - 1
+		}
+	}
+}
+
+// key is used to hash-cons the sets
+func (b bitset) key() string {
+	var sb strings.Builder
+	sb.Grow(len(b) * 8)
+	for _, w := range b {
+		for k := uint(0); k < 64; k += 8 {
+			sb.WriteByte(byte(w >> k))
+		}
+	}
+	return sb.String()
+}
+
+// subsetBuilder runs the subset construction on numbered states. The nfa
+// states are numbered in sorted order, so that members of a set come out
+// sorted like Set.String() does.
+type subsetBuilder struct {
+	names   []string
+	symbols []string
+	trans   [][]bitset // trans[state][symbol], already eclosed
+	final   bitset
+	attrs   []map[string]string
+
+	sets  []bitset       // dfa states
+	index map[string]int // bitset key -> dfa state
+	delta [][]int        // delta[dfa state][symbol], -1 if none
+}
+
+func newSubsetBuilder(nfa NFAAutomata) *subsetBuilder {
+	enfa, is_enfa := nfa.(*eNFA)
+	states := nfa.GetStates()
+	all := NewSet() // states without an NFAstate get a number too
+	all.Insert(nfa.GetStart())
+	for f, _ := range nfa.GetFinish() {
+		all.Insert(f)
+	}
+	symbols := NewSet()
+	for state, state_obj := range states {
+		all.Insert(state)
+		for sb, dsts := range state_obj.Trans {
+			if !(is_enfa && sb == epsilon) {
+				symbols.Insert(sb)
+			}
+			for dst, _ := range dsts {
+				all.Insert(dst)
+			}
+		}
+	}
+
+	b := &subsetBuilder{index: make(map[string]int)}
+	for state, _ := range all {
+		b.names = append(b.names, state)
+	}
+	sort.Strings(b.names)
+	for sb, _ := range symbols {
+		b.symbols = append(b.symbols, sb)
+	}
+	sort.Strings(b.symbols)
+	number := make(map[string]int)
+	for i, name := range b.names {
+		number[name] = i
+	}
+
+	n := len(b.names)
+	closure := make([]bitset, n)
+	for i, name := range b.names {
+		closure[i] = newBitset(n)
+		if is_enfa {
+			for dst, _ := range enfa.closure(name) {
+				closure[i].insert(number[dst])
+			}
+		} else {
+			closure[i].insert(i)
+		}
+	}
+	b.final = newBitset(n)
+	for f, _ := range nfa.GetFinish() {
+		if i, ok := number[f]; ok {
+			b.final.insert(i)
+		}
+	}
+	b.trans = make([][]bitset, n)
+	b.attrs = make([]map[string]string, n)
+	for i, name := range b.names {
+		b.trans[i] = make([]bitset, len(b.symbols))
+		state_obj, ok := states[name]
+		if ok {
+			b.attrs[i] = state_obj.Attr
+		}
+		for k, sb := range b.symbols {
+			if !ok {
+				continue
+			}
+			dsts, ok := state_obj.Trans[sb]
+			if !ok {
+				continue
+			}
+			b.trans[i][k] = newBitset(n)
+			for dst, _ := range dsts {
+				b.trans[i][k].union(closure[number[dst]])
+			}
+		}
+	}
+
+	b.add(closure[number[nfa.GetStart()]])
+	return b
+}
+
+// add hash-conses the set and returns its dfa state
+func (b *subsetBuilder) add(set bitset) int {
+	key := set.key()
+	if i, ok := b.index[key]; ok {
+		return i
+	}
+	i := len(b.sets)
+	b.index[key] = i
+	b.sets = append(b.sets, set)
+	return i
+}
+
+// expand computes the moves of dfa state i, which adds the new sets
+func (b *subsetBuilder) expand(i int) {
+	row := make([]int, len(b.symbols))
+	set := b.sets[i]
+	for k, _ := range b.symbols {
+		next := b.move(set, k)
+		if next.empty() {
+			row[k] = -1
+			continue
+		}
+		row[k] = b.add(next)
+	}
+	b.delta = append(b.delta, row)
+}
+
+// move returns the eclosed set reached from set by symbol k
+func (b *subsetBuilder) move(set bitset, k int) bitset {
+	next := newBitset(len(b.names))
+	set.each(func(s int) {
+		if b.trans[s][k] != nil {
+			next.union(b.trans[s][k])
+		}
+	})
+	return next
+}
+
+func (b *subsetBuilder) name(i int) string {
+	return b.setName(b.sets[i])
+}
+
+func (b *subsetBuilder) setName(set bitset) string {
+	var members []string
+	set.each(func(s int) {
+		members = append(members, b.names[s])
+	})
+	return strings.Join(members, ",")
+}
+
+// dfa builds the DFA of the expanded states, named like Set.String() of
+// the nfa states they hold and with their Attr merged
+func (b *subsetBuilder) dfa(merge AttrMerge) *DFA {
+	return b.build(merge, b.name)
+}
+
+// dropInert leaves out of the sets the states that are not final and have
+// no moves on symbols, like the start of an eNFA with only epsilon moves.
+// They change nothing but which sets are told apart. Call it first thing.
+func (b *subsetBuilder) dropInert() {
+	live := newBitset(len(b.names))
+	for i, _ := range b.names {
+		if b.final.has(i) {
+			live.insert(i)
+		}
+		for _, next := range b.trans[i] {
+			if next != nil {
+				live.insert(i)
+			}
+		}
+	}
+	for _, row := range b.trans {
+		for _, next := range row {
+			if next != nil {
+				next.intersect(live)
+			}
+		}
+	}
+	b.sets[0].intersect(live)
+	b.index = map[string]int{b.sets[0].key(): 0}
+}
+
+// numberedDFA is ToDFA without inert states, naming the states 0, 1, ... in
+// the order found. Unlike the names of ToDFA these are unique even when nfa
+// state ids hold commas.
+func numberedDFA(nfa NFAAutomata) *DFA {
+	b := newSubsetBuilder(nfa)
+	b.dropInert()
+	for i := 0; i < len(b.sets); i++ {
+		b.expand(i)
+	}
+	return b.build(nil, strconv.Itoa)
+}
+
+func (b *subsetBuilder) build(merge AttrMerge, name func(int) string) *DFA {
+	dfa := NewDFA()
+	names := make([]string, len(b.sets))
+	for i, _ := range b.sets {
+		names[i] = name(i)
+		s := NewDFAstate()
+		s.Id = names[i]
+		dfa.States[names[i]] = s
+		var attrs []map[string]string
+		b.sets[i].each(func(m int) {
+			attrs = append(attrs, b.attrs[m])
+		})
+		mergeAttr(s.Attr, merge, attrs...)
+		if b.sets[i].intersects(b.final) {
+			dfa.Finish.Insert(names[i])
+		}
+	}
+	for i, row := range b.delta {
+		for k, dst := range row {
+			if dst >= 0 {
+				dfa.States[names[i]].Trans[b.symbols[k]] = names[dst]
+			}
+		}
+	}
+	for _, sb := range b.symbols {
+		dfa.Symbols[sb] = nil
+	}
+	dfa.Start = names[0]
+	return dfa
+}
+
+var ErrStateLimitExceeded = errors.New("dfa state limit exceeded")
+
+// ToDFAOptions bounds ToDFAWithOptions, the zero value bounds nothing
+type ToDFAOptions struct {
+	MaxStates        int              // stop once the dfa has more states, 0 for no limit
+	Progress         func(ToDFAStats) // called every ProgressInterval expanded states
+	ProgressInterval int              // 1024 if 0
+	MergeAttr        AttrMerge        // MergeAttrUnion if nil
+}
+
+// ToDFAStats tells how far the subset construction got
+type ToDFAStats struct {
+	States      int // dfa states found
+	Expanded    int // dfa states whose transitions are computed
+	Transitions int
+	Elapsed     time.Duration
+}
+
+// ToDFAWithOptions is ToDFA with limits. It stops with ErrStateLimitExceeded
+// when the dfa grows over opts.MaxStates, or with ctx.Err() when ctx is done,
+// and then returns no dfa but the statistics so far.
+func ToDFAWithOptions(ctx context.Context, nfa NFAAutomata, opts ToDFAOptions) (*DFA, ToDFAStats, error) {
+	begin := time.Now()
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = 1024
+	}
+	var stats ToDFAStats
+	b := newSubsetBuilder(nfa)
+	for i := 0; i < len(b.sets); i++ {
+		if err := ctx.Err(); err != nil {
+			stats.Elapsed = time.Since(begin)
+			return nil, stats, err
+		}
+		b.expand(i)
+		stats.States = len(b.sets)
+		stats.Expanded = i + 1
+		for _, dst := range b.delta[i] {
+			if dst >= 0 {
+				stats.Transitions++
+			}
+		}
+		if opts.MaxStates > 0 && stats.States > opts.MaxStates {
+			stats.Elapsed = time.Since(begin)
+			return nil, stats, ErrStateLimitExceeded
+		}
+		if opts.Progress != nil && stats.Expanded%interval == 0 {
+			stats.Elapsed = time.Since(begin)
+			opts.Progress(stats)
+		}
+	}
+	stats.Elapsed = time.Since(begin)
+	return b.dfa(opts.MergeAttr), stats, nil
+}
@@ -0,0 +1,369 @@
+package automata
+
+import "sort"
+import "strings"
+
+// ToRegex turns any automata into a regular expression by state elimination.
+// The result is simplified with the usual identities and uses the syntax of
+// ParseRegex, so it parses back for machines with one character symbols.
+// The empty language, which ParseRegex has no syntax for, gives "∅".
+func ToRegex(at Automata) string {
+	at = unwrap(at)
+	_, is_enfa := at.(*eNFA)
+	edges := make(map[string]map[string]*rexp) // edges[from][to]
+	add_edge := func(from string, to string, r *rexp) {
+		if _, ok := edges[from]; !ok {
+			edges[from] = make(map[string]*rexp)
+		}
+		edges[from][to] = rexpAlt(edges[from][to], r)
+	}
+
+	// fresh start and final states, outside the names of the automata
+	used := NewSet()
+	used.Insert(at.GetStart())
+	for _, record := range at.TransTable() {
+		used.Insert(record[0])
+		used.Insert(record[2])
+	}
+	start, final := "^", "$"
+	for used.Has(start) {
+		start += "^"
+	}
+	for used.Has(final) {
+		final += "$"
+	}
+
+	add_edge(start, at.GetStart(), rexpEpsilon)
+	for f, _ := range at.GetFinish() {
+		add_edge(f, final, rexpEpsilon)
+	}
+	for _, record := range at.TransTable() {
+		if is_enfa && record[1] == epsilon {
+			add_edge(record[0], record[2], rexpEpsilon)
+		} else {
+			add_edge(record[0], record[2], &rexp{kind: reSymbol, symbol: record[1]})
+		}
+	}
+
+	states := NewSet()
+	for from, dsts := range edges {
+		states.Insert(from)
+		for to, _ := range dsts {
+			states.Insert(to)
+		}
+	}
+	states.Delete(start)
+	states.Delete(final)
+
+	for len(states) > 0 {
+		// eliminate the state making the fewest new edges, ties by name
+		var k string
+		best := -1
+		for s, _ := range states {
+			in, out := 0, 0
+			for from, dsts := range edges {
+				if _, ok := dsts[s]; ok && from != s {
+					in++
+				}
+			}
+			for to, _ := range edges[s] {
+				if to != s {
+					out++
+				}
+			}
+			if best < 0 || in*out < best || (in*out == best && s < k) {
+				k, best = s, in*out
+			}
+		}
+		states.Delete(k)
+
+		loop := rexpStar(edges[k][k])
+		for from, dsts := range edges {
+			into, ok := dsts[k]
+			if !ok || from == k {
+				continue
+			}
+			for to, out := range edges[k] {
+				if to == k {
+					continue
+				}
+				path := rexpCat(rexpCat(into, loop), out)
+				dsts[to] = rexpAlt(dsts[to], path)
+			}
+			delete(dsts, k)
+		}
+		delete(edges, k)
+	}
+
+	r := edges[start][final]
+	if r == nil {
+		return "∅"
+	}
+	return r.String()
+}
+
+const (
+	reEps = iota
+	reSymbol
+	reCat
+	reAlt
+	reStar
+)
+
+// regular expression tree, nil being the empty language
+type rexp struct {
+	kind   int
+	symbol string
+	subs   []*rexp
+	str    string // cached print()
+	level  int
+}
+
+var rexpEpsilon = &rexp{kind: reEps, level: 3}
+
+// rexpAlt builds a|b with ∅|r = r, r|r = r and ε|r* = ε|rr* = ε|r*r = r*
+func rexpAlt(a *rexp, b *rexp) *rexp {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var subs []*rexp
+	for _, r := range []*rexp{a, b} {
+		if r.kind == reAlt {
+			subs = append(subs, r.subs...)
+		} else {
+			subs = append(subs, r)
+		}
+	}
+	has_eps := false
+	for _, r := range subs {
+		if r.kind == reEps {
+			has_eps = true
+		}
+	}
+	has_star := false
+	for i, r := range subs {
+		if p := plusOf(r); has_eps && p != nil {
+			subs[i] = rexpStar(p)
+		}
+		if subs[i].kind == reStar {
+			has_star = true
+		}
+	}
+	seen := NewSet()
+	var uniq []*rexp
+	for _, r := range subs {
+		if has_star && r.kind == reEps { // ε|r* = r*
+			continue
+		}
+		if !seen.Has(r.String()) {
+			seen.Insert(r.String())
+			uniq = append(uniq, r)
+		}
+	}
+	if len(uniq) == 1 {
+		return uniq[0]
+	}
+	sort.Slice(uniq, func(i, j int) bool {
+		return uniq[i].String() < uniq[j].String()
+	})
+	return &rexp{kind: reAlt, subs: uniq}
+}
+
+// rexpCat builds ab with ∅r = ∅, εr = r and r*r* = r*
+func rexpCat(a *rexp, b *rexp) *rexp {
+	if a == nil || b == nil {
+		return nil
+	}
+	if a.kind == reEps {
+		return b
+	}
+	if b.kind == reEps {
+		return a
+	}
+	var subs []*rexp
+	for _, r := range []*rexp{a, b} {
+		if r.kind == reCat {
+			subs = append(subs, r.subs...)
+		} else {
+			subs = append(subs, r)
+		}
+	}
+	var merged []*rexp
+	for _, r := range subs {
+		if n := len(merged); n > 0 && r.kind == reStar && merged[n-1].kind == reStar && merged[n-1].String() == r.String() {
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return rexpCatOf(merged)
+}
+
+func rexpCatOf(subs []*rexp) *rexp {
+	if len(subs) == 1 {
+		return subs[0]
+	}
+	return &rexp{kind: reCat, subs: subs}
+}
+
+// plusOf returns r when p is rr* or r*r, nil otherwise
+func plusOf(p *rexp) *rexp {
+	if p.kind != reCat {
+		return nil
+	}
+	n := len(p.subs)
+	if last := p.subs[n-1]; last.kind == reStar {
+		if r := rexpCatOf(p.subs[:n-1]); r.String() == last.subs[0].String() {
+			return r
+		}
+	}
+	if first := p.subs[0]; first.kind == reStar {
+		if r := rexpCatOf(p.subs[1:]); r.String() == first.subs[0].String() {
+			return r
+		}
+	}
+	return nil
+}
+
+// rexpStar builds r* with ∅* = ε* = ε, (r*)* = (rr*)* = r* and (ε|r)* = r*
+func rexpStar(r *rexp) *rexp {
+	if r == nil || r.kind == reEps {
+		return rexpEpsilon
+	}
+	if r.kind == reStar {
+		return r
+	}
+	if p := plusOf(r); p != nil {
+		return rexpStar(p)
+	}
+	if r.kind == reAlt {
+		var subs []*rexp
+		for _, sub := range r.subs {
+			if sub.kind != reEps {
+				subs = append(subs, sub)
+			}
+		}
+		if len(subs) == 1 {
+			return rexpStar(subs[0])
+		}
+		if len(subs) < len(r.subs) {
+			r = &rexp{kind: reAlt, subs: subs}
+		}
+	}
+	return &rexp{kind: reStar, subs: []*rexp{r}}
+}
+
+func (r *rexp) String() string {
+	s, _ := r.print()
+	return s
+}
+
+// print returns the expression with how tightly it binds: 0 for a|b, 1 for
+// ab, 2 for a* and a?, 3 for a single character, a class or a group
+func (r *rexp) print() (string, int) {
+	if r.str == "" && r.kind != reEps {
+		r.str, r.level = r.printNew()
+	}
+	return r.str, r.level
+}
+
+func (r *rexp) printNew() (string, int) {
+	group := func(sub *rexp, level int) string {
+		s, l := sub.print()
+		if l < level {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	switch r.kind {
+	case reSymbol:
+		var sb strings.Builder
+		for _, c := range r.symbol {
+			if strings.ContainsRune(`\|*+?()[]`, c) {
+				sb.WriteRune('\\')
+			}
+			sb.WriteRune(c)
+		}
+		if len([]rune(r.symbol)) == 1 {
+			return sb.String(), 3
+		}
+		return sb.String(), 1
+	case reCat:
+		var sb strings.Builder
+		for _, sub := range r.subs {
+			sb.WriteString(group(sub, 1))
+		}
+		return sb.String(), 1
+	case reAlt:
+		// ε|r is written r? and single characters are gathered in a class
+		optional := false
+		var class []rune
+		var alts []string
+		level := 0
+		for _, sub := range r.subs {
+			if sub.kind == reEps {
+				optional = true
+			} else if sub.kind == reSymbol && len([]rune(sub.symbol)) == 1 {
+				class = append(class, []rune(sub.symbol)[0])
+			} else {
+				s, l := sub.print()
+				alts = append(alts, s)
+				level = l
+			}
+		}
+		if len(class) == 1 {
+			alts = append(alts, (&rexp{kind: reSymbol, symbol: string(class)}).String())
+			level = 3
+		} else if len(class) > 1 {
+			alts = append(alts, classString(class))
+			level = 3
+		}
+		sort.Strings(alts)
+		s := strings.Join(alts, "|")
+		if len(alts) > 1 {
+			level = 0
+		}
+		if !optional {
+			return s, level
+		}
+		if level < 3 {
+			s = "(" + s + ")"
+		}
+		return s + "?", 2
+	case reStar:
+		return group(r.subs[0], 3) + "*", 2
+	}
+	return "", 3
+}
+
+// classString writes the characters as [...], with runs of three or more
+// merged into ranges
+func classString(class []rune) string {
+	sort.Slice(class, func(i, j int) bool { return class[i] < class[j] })
+	var sb strings.Builder
+	write := func(c rune) {
+		if strings.ContainsRune(`\]-^`, c) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	sb.WriteRune('[')
+	for i := 0; i < len(class); {
+		j := i
+		for j+1 < len(class) && class[j+1] == class[j]+1 {
+			j++
+		}
+		write(class[i])
+		if j-i >= 2 {
+			sb.WriteRune('-')
+			write(class[j])
+		} else if j > i {
+			write(class[j])
+		}
+		i = j + 1
+	}
+	sb.WriteRune(']')
+	return sb.String()
+}
@@ -0,0 +1,191 @@
+package automata
+
+import "fmt"
+import "strings"
+
+type TraceResult int
+
+const (
+	TraceAccepted TraceResult = iota
+	TraceStuck                // a symbol had no transition, as when DFA.Trans gives ""
+	TraceNotFinal             // all input read, but no finish state active
+)
+
+func (r TraceResult) String() string {
+	switch r {
+	case TraceAccepted:
+		return "accepted"
+	case TraceStuck:
+		return "stuck"
+	case TraceNotFinal:
+		return "not final"
+	}
+	return fmt.Sprintf("TraceResult(%d)", int(r))
+}
+
+type TraceEdge struct {
+	From, To string
+}
+
+type TraceStep struct {
+	Symbol  string      // consumed to get here, "" for the start
+	Moves   []TraceEdge // transitions on Symbol out of the previous states
+	Epsilon []TraceEdge // epsilon moves between the states, eNFA only
+	States  []string    // active states after epsilon closure, sorted
+}
+
+// Trace is a run of an automata on some input. Steps[0] holds the start
+// states and Steps[i] the states after Symbols[i-1]. When stuck, the run
+// ends at Steps[Pos] and Symbols[Pos] is the symbol with no transition.
+type Trace struct {
+	Symbols []string
+	Steps   []TraceStep
+	Result  TraceResult
+	Pos     int // symbols consumed
+	finish  Set
+}
+
+// Explain runs the automata on symbols like Accept does, recording every step
+func Explain(at Automata, symbols []string) *Trace {
+	at = unwrap(at)
+	_, is_enfa := at.(*eNFA)
+	graph := transGraph(at)
+	epsilon_edges := func(states Set) []TraceEdge {
+		var edges []TraceEdge
+		if !is_enfa {
+			return edges
+		}
+		for _, state := range sortedKeys(states) {
+			for _, e := range graph[state] {
+				if e.symbol == "" {
+					edges = append(edges, TraceEdge{state, e.to})
+				}
+			}
+		}
+		return edges
+	}
+
+	t := &Trace{Symbols: symbols, finish: at.GetFinish()}
+	states := startStates(at)
+	t.Steps = append(t.Steps, TraceStep{Epsilon: epsilon_edges(states), States: sortedKeys(states)})
+	for _, sb := range symbols {
+		var moves []TraceEdge
+		for _, state := range sortedKeys(states) {
+			for _, e := range graph[state] {
+				if e.symbol == sb && sb != "" {
+					moves = append(moves, TraceEdge{state, e.to})
+				}
+			}
+		}
+		if len(moves) == 0 {
+			t.Result = TraceStuck
+			return t
+		}
+		states = nextStates(at, states, sb)
+		t.Steps = append(t.Steps, TraceStep{sb, moves, epsilon_edges(states), sortedKeys(states)})
+		t.Pos++
+	}
+	t.Result = TraceNotFinal
+	for state, _ := range states {
+		if t.finish.Has(state) {
+			t.Result = TraceAccepted
+		}
+	}
+	return t
+}
+
+func (t *Trace) Accepted() bool {
+	return t.Result == TraceAccepted
+}
+
+// Reason says in words why the input was rejected, "" when accepted
+func (t *Trace) Reason() string {
+	last := t.Steps[len(t.Steps)-1].States
+	switch t.Result {
+	case TraceStuck:
+		return fmt.Sprintf("no transition for %s at position %d from {%s}",
+			formatToken(t.Symbols[t.Pos]), t.Pos, strings.Join(last, ","))
+	case TraceNotFinal:
+		return fmt.Sprintf("input ended in {%s}, none of them final", strings.Join(last, ","))
+	}
+	return ""
+}
+
+func traceEdges(edges []TraceEdge, label string) []string {
+	var l []string
+	for _, e := range edges {
+		l = append(l, fmt.Sprintf("%s -%s-> %s", e.From, label, e.To))
+	}
+	return l
+}
+
+// String renders one line per step and the outcome:
+//
+//	0: {q0,q1}  q0 -ε-> q1
+//	1 a: {q2}  q1 -a-> q2
+//	rejected: input ended in {q2}, none of them final
+func (t *Trace) String() string {
+	var sb strings.Builder
+	for i, step := range t.Steps {
+		if i == 0 {
+			fmt.Fprintf(&sb, "0: {%s}", strings.Join(step.States, ","))
+		} else {
+			fmt.Fprintf(&sb, "%d %s: {%s}", i, formatToken(step.Symbol), strings.Join(step.States, ","))
+		}
+		edges := append(traceEdges(step.Moves, step.Symbol), traceEdges(step.Epsilon, "ε")...)
+		if len(edges) > 0 {
+			fmt.Fprintf(&sb, "  %s", strings.Join(edges, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	if t.Accepted() {
+		sb.WriteString("accepted\n")
+	} else {
+		fmt.Fprintf(&sb, "rejected: %s\n", t.Reason())
+	}
+	return sb.String()
+}
+
+// ToDOT draws the run left to right, one column of states per step. A stuck
+// run ends in a box naming the symbol.
+func (t *Trace) ToDOT() string {
+	node := func(i int, state string) string {
+		return dotQuote(fmt.Sprintf("%d:%s", i, state))
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph trace {\n")
+	fmt.Fprintf(&sb, "\trankdir=LR;\n")
+	outcome := "accepted"
+	if !t.Accepted() {
+		outcome = "rejected: " + t.Reason()
+	}
+	fmt.Fprintf(&sb, "\tlabel=%s;\n", dotQuote(outcome))
+	for i, step := range t.Steps {
+		var nodes []string
+		for _, state := range step.States {
+			shape := "circle"
+			if t.finish.Has(state) {
+				shape = "doublecircle"
+			}
+			fmt.Fprintf(&sb, "\t%s [shape=%s, label=%s];\n", node(i, state), shape, dotQuote(state))
+			nodes = append(nodes, node(i, state))
+		}
+		fmt.Fprintf(&sb, "\t{rank=same; %s;}\n", strings.Join(nodes, "; "))
+		for _, e := range step.Moves {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=%s];\n", node(i-1, e.From), node(i, e.To), dotQuote(step.Symbol))
+		}
+		for _, e := range step.Epsilon {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=\"ε\", style=dashed];\n", node(i, e.From), node(i, e.To))
+		}
+	}
+	if t.Result == TraceStuck {
+		last := len(t.Steps) - 1
+		stuck := dotQuote(fmt.Sprintf("%d:stuck", last+1))
+		fmt.Fprintf(&sb, "\t%s [shape=box, label=%s];\n", stuck, dotQuote("no transition for "+t.Symbols[t.Pos]))
+		for _, state := range t.Steps[last].States {
+			fmt.Fprintf(&sb, "\t%s -> %s [style=dotted];\n", node(last, state), stuck)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}